@@ -0,0 +1,326 @@
+// raftsim runs a Raft cluster from pkg/raft and drives it with a script of
+// failures, printing elections and commits as they happen.
+//
+// Usage:
+//
+//	go run ./cmd/raftsim                     # run the built-in scenario
+//	go run ./cmd/raftsim -script failures.txt
+//	go run ./cmd/raftsim -script -           # read commands from stdin
+//
+// Script commands, one per line (# starts a comment):
+//
+//	sleep 500ms              let the cluster run
+//	put x=1                  propose on the current leader
+//	put x=1 @2               propose on node 2, even if it is a stale leader
+//	crash 2 / restart 2      stop a node / start it again with its log
+//	partition 0,1 2,3,4      split the network; unlisted nodes are isolated
+//	heal                     remove all partitions
+//	drop 0.2                 lose 20% of messages
+//	latency 5ms 50ms         set the message delay range
+//	await leader [2s]        wait for a leader
+//	await converged [2s]     wait until every running node has the leader's log
+//	status                   print every node
+//	check                    verify Raft's safety properties
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"Golan-Concepts/pkg/raft"
+)
+
+const defaultScript = `
+# Elect a leader and replicate a few commands.
+await leader
+put x=1
+put y=2
+await converged
+status
+
+# Crash the leader: the others elect a new one and keep going.
+crash leader
+await leader
+put z=3
+await converged
+status
+
+# Bring it back: it catches up from the new leader.
+restart last
+await converged
+
+# Partition the leader into a minority. Its writes cannot commit.
+partition leader,next rest
+put x=lost @leader
+sleep 600ms
+put x=4
+sleep 100ms
+status
+
+# Heal: the old leader steps down and its uncommitted entry is replaced.
+heal
+await converged
+status
+
+# A lossy, slow network still converges, just more slowly.
+drop 0.2
+latency 5ms 30ms
+put y=5
+await converged 5s
+status
+check
+`
+
+func main() {
+	nodes := flag.Int("nodes", 5, "number of nodes")
+	seed := flag.Int64("seed", 1, "random seed for timeouts and the network")
+	election := flag.Duration("election", 150*time.Millisecond, "minimum election timeout")
+	minLatency := flag.Duration("min-latency", time.Millisecond, "minimum message delay")
+	maxLatency := flag.Duration("max-latency", 5*time.Millisecond, "maximum message delay")
+	drop := flag.Float64("drop", 0, "fraction of messages lost")
+	script := flag.String("script", "", "script file, - for stdin (default: built-in scenario)")
+	quiet := flag.Bool("q", false, "do not print elections and commits")
+	flag.Parse()
+
+	var in io.Reader = strings.NewReader(defaultScript)
+	switch *script {
+	case "":
+	case "-":
+		in = os.Stdin
+	default:
+		f, err := os.Open(*script)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	cfg := raft.Config{
+		Nodes:           *nodes,
+		ElectionTimeout: *election,
+		MinLatency:      *minLatency,
+		MaxLatency:      *maxLatency,
+		DropRate:        *drop,
+		Seed:            *seed,
+	}
+	if !*quiet {
+		cfg.Logf = func(format string, args ...interface{}) {
+			fmt.Printf("  "+format+"\n", args...)
+		}
+	}
+	c := raft.NewCluster(cfg)
+	defer c.Stop()
+
+	s := &sim{c: c, leader: -1, last: -1}
+	scanner := bufio.NewScanner(in)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if i := strings.Index(text, "#"); i >= 0 {
+			text = strings.TrimSpace(text[:i])
+		}
+		if text == "" {
+			continue
+		}
+		fmt.Println(">", text)
+		if err := s.run(strings.Fields(text)); err != nil {
+			fmt.Printf("line %d: %v\n", line, err)
+		}
+	}
+}
+
+// sim runs script commands against a cluster. It remembers the leader it
+// last saw and the node it last crashed, so scripts can say "crash leader"
+// and "restart last" without knowing the IDs in advance.
+type sim struct {
+	c      *raft.Cluster
+	leader int
+	last   int
+}
+
+func (s *sim) run(args []string) error {
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "sleep":
+		d, err := s.duration(args, 0)
+		if err != nil {
+			return err
+		}
+		time.Sleep(d)
+
+	case "put":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: put key=value [@node]")
+		}
+		var index int
+		var err error
+		if len(args) > 1 && strings.HasPrefix(args[1], "@") {
+			var id int
+			if id, err = s.node(args[1][1:]); err != nil {
+				return err
+			}
+			index, err = s.c.ProposeAt(id, args[0])
+		} else {
+			index, err = s.c.Propose(args[0])
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("appended at index %d\n", index)
+
+	case "crash", "restart":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: %s <node>", cmd)
+		}
+		id, err := s.node(args[0])
+		if err != nil {
+			return err
+		}
+		if cmd == "crash" {
+			err = s.c.Crash(id)
+			s.last = id
+		} else {
+			err = s.c.Restart(id)
+		}
+		return err
+
+	case "partition":
+		var groups [][]int
+		used := map[int]bool{}
+		for _, arg := range args {
+			var group []int
+			if arg == "rest" {
+				for id := 0; id < s.c.Size(); id++ {
+					if !used[id] {
+						group = append(group, id)
+					}
+				}
+			} else {
+				for _, f := range strings.Split(arg, ",") {
+					id, err := s.node(f)
+					if err != nil {
+						return err
+					}
+					group = append(group, id)
+				}
+			}
+			for _, id := range group {
+				used[id] = true
+			}
+			groups = append(groups, group)
+		}
+		s.c.Network().Partition(groups...)
+		fmt.Println("groups:", groups)
+
+	case "heal":
+		s.c.Network().Heal()
+
+	case "drop":
+		if len(args) != 1 {
+			return fmt.Errorf("usage: drop <fraction>")
+		}
+		p, err := strconv.ParseFloat(args[0], 64)
+		if err != nil {
+			return err
+		}
+		s.c.Network().SetDropRate(p)
+
+	case "latency":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: latency <min> <max>")
+		}
+		min, err := time.ParseDuration(args[0])
+		if err != nil {
+			return err
+		}
+		max, err := time.ParseDuration(args[1])
+		if err != nil {
+			return err
+		}
+		s.c.Network().SetLatency(min, max)
+
+	case "await":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: await leader|converged [timeout]")
+		}
+		timeout, err := s.duration(args[1:], 2*time.Second)
+		if err != nil {
+			return err
+		}
+		start := time.Now()
+		switch args[0] {
+		case "leader":
+			if s.leader = s.c.WaitLeader(timeout); s.leader < 0 {
+				return fmt.Errorf("no leader after %v", timeout)
+			}
+			fmt.Printf("leader is node %d (after %v)\n", s.leader, time.Since(start).Round(time.Millisecond))
+		case "converged":
+			if !s.c.WaitConverged(timeout) {
+				return fmt.Errorf("not converged after %v", timeout)
+			}
+			s.leader = s.c.Leader()
+			fmt.Printf("converged (after %v)\n", time.Since(start).Round(time.Millisecond))
+		default:
+			return fmt.Errorf("unknown await %q", args[0])
+		}
+
+	case "status":
+		s.c.PrintStatus(os.Stdout)
+
+	case "check":
+		if err := s.c.Check(); err != nil {
+			return err
+		}
+		fmt.Println("safe: one leader per term, committed logs agree")
+
+	default:
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+	return nil
+}
+
+// node parses a node ID, or one of the names "leader" (the current leader),
+// "next" (the node after it) and "last" (the node crashed last).
+func (s *sim) node(name string) (int, error) {
+	var id int
+	switch name {
+	case "leader", "next":
+		if l := s.c.Leader(); l >= 0 {
+			s.leader = l
+		}
+		if s.leader < 0 {
+			return 0, raft.ErrNoLeader
+		}
+		id = s.leader
+		if name == "next" {
+			id = (id + 1) % s.c.Size()
+		}
+	case "last":
+		if s.last < 0 {
+			return 0, fmt.Errorf("no node has crashed yet")
+		}
+		id = s.last
+	default:
+		var err error
+		if id, err = strconv.Atoi(name); err != nil {
+			return 0, fmt.Errorf("bad node %q", name)
+		}
+	}
+	return id, nil
+}
+
+func (s *sim) duration(args []string, def time.Duration) (time.Duration, error) {
+	if len(args) == 0 {
+		if def == 0 {
+			return 0, fmt.Errorf("missing duration")
+		}
+		return def, nil
+	}
+	return time.ParseDuration(args[0])
+}
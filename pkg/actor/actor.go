@@ -0,0 +1,342 @@
+// actor.go
+//
+// This package implements the actor model on top of goroutines and channels.
+// Each actor owns its state and a mailbox; it handles one message at a time,
+// so the state needs no mutex. Actors run under a supervisor that restarts
+// them when they panic.
+
+package actor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ==============================
+// The Actor Model
+// ==============================
+//
+// "Do not communicate by sharing memory; instead, share memory by communicating."
+//
+// SafeCounter protects shared state with a mutex: every goroutine touches the
+// value, and the mutex takes turns. An actor turns this around: exactly one
+// goroutine ever touches the value, and everybody else sends it messages.
+//
+//     sender 1 --\
+//     sender 2 ----> [ mailbox (chan) ] ---> actor goroutine ---> state
+//     sender 3 --/
+//
+// Three ideas make actors practical:
+//
+// 1. Typed messages: the mailbox is a chan M, and the actor switches on the
+//    message type to decide what to do.
+// 2. Request/reply: a message can carry a reply channel. Ask sends such a
+//    message and waits for the answer, giving up when its context expires.
+// 3. Supervision: if the actor panics, its supervisor recovers the panic
+//    (like safeFunction in pkg/errors) and restarts it with fresh state.
+//    A restart-intensity limit stops an actor that keeps crashing from
+//    restarting forever.
+
+// ErrStopped is returned when sending to an actor that is no longer running.
+var ErrStopped = errors.New("actor: stopped")
+
+// ErrTooManyRestarts is the reason an actor stops after exceeding its
+// supervisor's restart intensity.
+var ErrTooManyRestarts = errors.New("actor: too many restarts")
+
+// ==============================
+// Actors
+// ==============================
+
+// Props describes how to run an actor with state S and messages M.
+type Props[S, M any] struct {
+	// Name identifies the actor in supervisor logs.
+	Name string
+	// Init returns the initial state. It is called again on every restart.
+	Init func() S
+	// Receive handles one message. It is never called concurrently.
+	Receive func(state *S, msg M)
+	// MailboxSize is the mailbox buffer. Senders block when it is full.
+	MailboxSize int
+}
+
+// Ref is the address of a running actor. It is safe to share between goroutines.
+type Ref[M any] struct {
+	name    string
+	mailbox chan M
+	done    chan struct{}
+	err     error
+}
+
+// Name returns the actor's name.
+func (r *Ref[M]) Name() string {
+	return r.name
+}
+
+// Send delivers msg to the actor's mailbox, blocking while the mailbox is full.
+func (r *Ref[M]) Send(msg M) error {
+	select {
+	case <-r.done:
+		return ErrStopped
+	default:
+	}
+	select {
+	case r.mailbox <- msg:
+		return nil
+	case <-r.done:
+		return ErrStopped
+	}
+}
+
+// Done is closed when the actor stops for good.
+func (r *Ref[M]) Done() <-chan struct{} {
+	return r.done
+}
+
+// Err returns why the actor stopped: nil after a normal supervisor shutdown,
+// or an error wrapping ErrTooManyRestarts. It must only be called after Done
+// is closed.
+func (r *Ref[M]) Err() error {
+	return r.err
+}
+
+// Ask sends a request built around a reply channel and waits for the answer.
+// The reply channel is buffered, so an actor answering after the caller gave
+// up never blocks.
+//
+//	value, err := actor.Ask(ctx, counter, func(reply chan<- int) CounterMsg {
+//	    return GetValue{Reply: reply}
+//	})
+func Ask[M, R any](ctx context.Context, ref *Ref[M], request func(reply chan<- R) M) (R, error) {
+	var zero R
+	reply := make(chan R, 1)
+	if err := ref.Send(request(reply)); err != nil {
+		return zero, err
+	}
+	select {
+	case r := <-reply:
+		return r, nil
+	case <-ref.done:
+		return zero, ErrStopped
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// ==============================
+// Supervisor
+// ==============================
+
+// Supervisor runs actors and restarts them when they panic. An actor that
+// crashes more than MaxRestarts times within Window is stopped for good.
+// A Supervisor literal with MaxRestarts and Window set is ready to use, as is
+// one from NewSupervisor.
+type Supervisor struct {
+	MaxRestarts int
+	Window      time.Duration
+	// Logf, if set, receives a line for every crash, restart and give-up.
+	Logf func(format string, args ...any)
+
+	initOnce sync.Once
+	stop     chan struct{} // created by stopped
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+// NewSupervisor returns a supervisor allowing maxRestarts restarts per actor
+// within window.
+func NewSupervisor(maxRestarts int, window time.Duration) *Supervisor {
+	return &Supervisor{MaxRestarts: maxRestarts, Window: window}
+}
+
+// stopped returns the channel Stop closes, creating it on first use.
+func (s *Supervisor) stopped() chan struct{} {
+	s.initOnce.Do(func() { s.stop = make(chan struct{}) })
+	return s.stop
+}
+
+// Stop asks every actor to finish its current message and exit, then waits
+// for all of them. Messages still in mailboxes are dropped.
+func (s *Supervisor) Stop() {
+	stop := s.stopped()
+	s.stopOnce.Do(func() { close(stop) })
+	s.wg.Wait()
+}
+
+func (s *Supervisor) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// Spawn starts an actor under the supervisor and returns its address.
+func Spawn[S, M any](s *Supervisor, props Props[S, M]) *Ref[M] {
+	ref := &Ref[M]{
+		name:    props.Name,
+		mailbox: make(chan M, props.MailboxSize),
+		done:    make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go supervise(s, props, ref)
+	return ref
+}
+
+// supervise runs the actor, restarting it with fresh state after each panic
+// until the restart intensity is exceeded or the supervisor stops.
+func supervise[S, M any](s *Supervisor, props Props[S, M], ref *Ref[M]) {
+	defer s.wg.Done()
+	defer close(ref.done)
+
+	var restarts []time.Time
+	for {
+		state := props.Init()
+		reason, crashed := run(s, props, ref, &state)
+		if !crashed {
+			return
+		}
+		s.logf("actor %s crashed: %v", props.Name, reason)
+
+		now := time.Now()
+		restarts = append(restarts, now)
+		for len(restarts) > 0 && now.Sub(restarts[0]) > s.Window {
+			restarts = restarts[1:]
+		}
+		if len(restarts) > s.MaxRestarts {
+			ref.err = fmt.Errorf("%s: %w (%d within %v)", props.Name, ErrTooManyRestarts, len(restarts), s.Window)
+			s.logf("actor %s: giving up: %v", props.Name, ref.err)
+			return
+		}
+		s.logf("actor %s restarted (%d/%d within %v)", props.Name, len(restarts), s.MaxRestarts, s.Window)
+	}
+}
+
+// run handles messages until the supervisor stops or Receive panics.
+func run[S, M any](s *Supervisor, props Props[S, M], ref *Ref[M], state *S) (reason any, crashed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			reason, crashed = r, true
+		}
+	}()
+	stop := s.stopped()
+	for {
+		select {
+		case msg := <-ref.mailbox:
+			props.Receive(state, msg)
+		case <-stop:
+			return nil, false
+		}
+	}
+}
+
+// ==============================
+// Example: Counter Actor
+// ==============================
+//
+// The actor version of SafeCounter. There is no mutex: the count lives in the
+// actor's state and only the actor goroutine reads or writes it.
+//
+// | SafeCounter (mutex)               | Counter actor                          |
+// |-----------------------------------|----------------------------------------|
+// | Every caller runs the update      | Only the actor runs the update         |
+// | Increment blocks on the lock      | Increment is a send; callers move on   |
+// | Value reads under the lock        | Value is a request/reply (Ask)         |
+// | A panic while locked can leave    | A panic restarts the actor with fresh  |
+// | the lock held forever             | state; other callers keep working      |
+
+// CounterMsg is implemented by every message the counter actor understands.
+type CounterMsg interface{ counterMsg() }
+
+// Increment adds one to the counter.
+type Increment struct{}
+
+// GetValue asks for the current count.
+type GetValue struct{ Reply chan<- int }
+
+// Crash makes the counter panic, to demonstrate supervision.
+type Crash struct{}
+
+func (Increment) counterMsg() {}
+func (GetValue) counterMsg()  {}
+func (Crash) counterMsg()     {}
+
+// NewCounter spawns a counter actor under s.
+func NewCounter(s *Supervisor, name string) *Ref[CounterMsg] {
+	return Spawn(s, Props[int, CounterMsg]{
+		Name:        name,
+		Init:        func() int { return 0 },
+		MailboxSize: 64,
+		Receive: func(count *int, msg CounterMsg) {
+			switch m := msg.(type) {
+			case Increment:
+				*count++
+			case GetValue:
+				m.Reply <- *count
+			case Crash:
+				panic("counter asked to crash")
+			}
+		},
+	})
+}
+
+// CounterValue asks a counter actor for its value, waiting at most timeout.
+func CounterValue(ref *Ref[CounterMsg], timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return Ask(ctx, ref, func(reply chan<- int) CounterMsg { return GetValue{Reply: reply} })
+}
+
+// TestActorCounter increments a counter actor from 5 goroutines, exactly like
+// TestMutex does with SafeCounter.
+func TestActorCounter() {
+	sup := NewSupervisor(3, time.Second)
+	defer sup.Stop()
+	counter := NewCounter(sup, "counter")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				counter.Send(Increment{})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// GetValue is queued behind every Increment already sent, so it sees all of them.
+	value, err := CounterValue(counter, time.Second)
+	fmt.Println("Final Counter (actor):", value, err)
+	// Expected Output: Final Counter (actor): 5000 <nil>
+}
+
+// TestSupervisor crashes a counter actor repeatedly. Each crash resets its
+// state; the fourth crash within a second exceeds the restart intensity and
+// the actor is stopped for good.
+func TestSupervisor() {
+	sup := NewSupervisor(3, time.Second)
+	sup.Logf = func(format string, args ...any) { fmt.Printf(format+"\n", args...) }
+	defer sup.Stop()
+	counter := NewCounter(sup, "counter")
+
+	for crash := 1; crash <= 4; crash++ {
+		counter.Send(Increment{})
+		value, _ := CounterValue(counter, time.Second)
+		fmt.Println("value before crash", crash, "=", value)
+		counter.Send(Crash{})
+	}
+
+	<-counter.Done()
+	fmt.Println("counter stopped:", counter.Err())
+	fmt.Println("send after stop:", counter.Send(Increment{}))
+	// value before crash 1 = 1
+	// actor counter crashed: counter asked to crash
+	// actor counter restarted (1/3 within 1s)
+	// ...
+	// actor counter: giving up: counter: actor: too many restarts (4 within 1s)
+	// counter stopped: counter: actor: too many restarts (4 within 1s)
+	// send after stop: actor: stopped
+}
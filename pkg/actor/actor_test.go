@@ -0,0 +1,97 @@
+// actor_test.go
+//
+// Tests for actors, Ask and the supervisor's restart intensity.
+
+package actor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitDone fails t unless ref stops within a second.
+func waitDone(t *testing.T, ref *Ref[CounterMsg]) {
+	t.Helper()
+	select {
+	case <-ref.Done():
+	case <-time.After(time.Second):
+		t.Fatal("actor did not stop")
+	}
+}
+
+func TestSupervisorGivesUpAfterMaxRestarts(t *testing.T) {
+	sup := &Supervisor{MaxRestarts: 2, Window: time.Minute}
+	defer sup.Stop()
+	counter := NewCounter(sup, "counter")
+
+	for crash := 1; crash <= 2; crash++ {
+		counter.Send(Increment{})
+		counter.Send(Crash{})
+		// The restart reset the state, and the actor still answers.
+		if v, err := CounterValue(counter, time.Second); err != nil || v != 0 {
+			t.Fatalf("after crash %d: value %d, %v; want 0, <nil>", crash, v, err)
+		}
+	}
+
+	counter.Send(Crash{}) // MaxRestarts+1 crashes within Window
+	waitDone(t, counter)
+	if err := counter.Err(); !errors.Is(err, ErrTooManyRestarts) {
+		t.Fatalf("Err = %v, want ErrTooManyRestarts", err)
+	}
+}
+
+func TestSupervisorForgetsCrashesOutsideWindow(t *testing.T) {
+	sup := &Supervisor{MaxRestarts: 1, Window: 20 * time.Millisecond}
+	defer sup.Stop()
+	counter := NewCounter(sup, "counter")
+
+	for crash := 1; crash <= 3; crash++ {
+		counter.Send(Crash{})
+		if _, err := CounterValue(counter, time.Second); err != nil {
+			t.Fatalf("after crash %d: %v", crash, err)
+		}
+		time.Sleep(50 * time.Millisecond) // let the crash leave the window
+	}
+}
+
+func TestAskReturnsContextError(t *testing.T) {
+	sup := &Supervisor{MaxRestarts: 1, Window: time.Second}
+	defer sup.Stop()
+	silent := Spawn(sup, Props[struct{}, CounterMsg]{
+		Name:    "silent",
+		Init:    func() struct{} { return struct{}{} },
+		Receive: func(*struct{}, CounterMsg) {}, // never replies
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := Ask(ctx, silent, func(reply chan<- int) CounterMsg { return GetValue{Reply: reply} })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Ask = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestSendAfterStopReturnsErrStopped(t *testing.T) {
+	sup := &Supervisor{MaxRestarts: 1, Window: time.Second}
+	counter := NewCounter(sup, "counter")
+	sup.Stop()
+	waitDone(t, counter)
+
+	if err := counter.Send(Increment{}); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Send = %v, want ErrStopped", err)
+	}
+	if _, err := CounterValue(counter, time.Second); !errors.Is(err, ErrStopped) {
+		t.Fatalf("Ask = %v, want ErrStopped", err)
+	}
+	if err := counter.Err(); err != nil {
+		t.Fatalf("Err after Stop = %v, want nil", err)
+	}
+}
+
+func TestZeroSupervisorStop(t *testing.T) {
+	var sup Supervisor
+	sup.Stop()
+	sup.Stop()
+}
@@ -0,0 +1,341 @@
+// bank.go
+//
+// This package simulates concurrent transfers between bank accounts, each
+// protected by its own mutex, and compares three ways of avoiding the AB/BA
+// deadlock: a global lock order, try-lock with backoff, and one global lock.
+// An auditor checks that no money is created or lost while transfers run.
+
+package bank
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ==============================
+// The Transfer Deadlock
+// ==============================
+//
+// A transfer must change two balances atomically, so it locks both accounts.
+// The obvious code locks the source, then the destination:
+//
+//     from.mu.Lock()
+//     to.mu.Lock()      // transfer(A, B) holds A and waits for B,
+//     ...               // transfer(B, A) holds B and waits for A
+//
+// Two opposite transfers at the same moment deadlock: the AB/BA cycle that
+// concurrency-lockorder.go detects, with the lock order chosen by the data
+// rather than the code. The strategies below avoid it in different ways:
+//
+// - Ordered:  always lock the account with the lower ID first. Every
+//             goroutine agrees on the order, so no cycle can form.
+// - TryLock:  lock the source, then only try the destination; on failure
+//             release the source, back off and start again. No goroutine
+//             waits while holding a lock, but busy accounts cause retries.
+// - Global:   one mutex for the whole bank. Trivially correct, but only one
+//             transfer runs at a time, however many accounts there are.
+
+// Account is a balance protected by its own mutex.
+type Account struct {
+	ID      int
+	mu      sync.Mutex
+	balance int64
+}
+
+// Bank is a set of accounts.
+type Bank struct {
+	accounts []*Account
+	global   sync.Mutex    // used by the Global strategy and by Audit
+	hold     time.Duration // how long a transfer keeps its locks
+}
+
+// New returns a bank with n accounts holding initial each.
+func New(n int, initial int64) *Bank {
+	b := &Bank{}
+	for i := 0; i < n; i++ {
+		b.accounts = append(b.accounts, &Account{ID: i, balance: initial})
+	}
+	return b
+}
+
+// Audit returns the total of all balances. It locks the bank and every
+// account (in ID order), so it sees no transfer half-done, whichever
+// strategy is running.
+func (b *Bank) Audit() int64 {
+	b.global.Lock()
+	defer b.global.Unlock()
+	for _, a := range b.accounts {
+		a.mu.Lock()
+	}
+	var total int64
+	for _, a := range b.accounts {
+		total += a.balance
+		a.mu.Unlock()
+	}
+	return total
+}
+
+// move changes both balances. The caller holds whatever the strategy needs.
+// A transfer that would overdraw the source is refused.
+func (b *Bank) move(from, to *Account, amount int64) bool {
+	if from.balance < amount {
+		return false
+	}
+	if b.hold > 0 {
+		time.Sleep(b.hold) // writing the journal, calling the fraud check, ...
+	}
+	from.balance -= amount
+	to.balance += amount
+	return true
+}
+
+// ==============================
+// Strategies
+// ==============================
+
+// Strategy is a way of locking two accounts for a transfer.
+type Strategy interface {
+	Name() string
+	// transfer moves amount from one account to the other and reports
+	// whether it was done, and how many times it had to start over.
+	transfer(b *Bank, from, to *Account, amount int64, rng *rand.Rand) (ok bool, retries int)
+}
+
+// The strategies, ready to use in Config.
+var (
+	Ordered Strategy = ordered{}
+	TryLock Strategy = tryLock{}
+	Global  Strategy = global{}
+
+	Strategies = []Strategy{Ordered, TryLock, Global}
+)
+
+type ordered struct{}
+
+func (ordered) Name() string { return "ordered" }
+
+func (ordered) transfer(b *Bank, from, to *Account, amount int64, rng *rand.Rand) (bool, int) {
+	first, second := from, to
+	if second.ID < first.ID {
+		first, second = second, first
+	}
+	first.mu.Lock()
+	second.mu.Lock()
+	ok := b.move(from, to, amount)
+	second.mu.Unlock()
+	first.mu.Unlock()
+	return ok, 0
+}
+
+type tryLock struct{}
+
+func (tryLock) Name() string { return "try-lock" }
+
+func (tryLock) transfer(b *Bank, from, to *Account, amount int64, rng *rand.Rand) (bool, int) {
+	backoff := time.Microsecond
+	for retries := 0; ; retries++ {
+		from.mu.Lock()
+		if to.mu.TryLock() {
+			ok := b.move(from, to, amount)
+			to.mu.Unlock()
+			from.mu.Unlock()
+			return ok, retries
+		}
+		from.mu.Unlock()
+		// Without the random part, two goroutines that collided would retry
+		// in lockstep and collide again (livelock).
+		if retries < 2 {
+			runtime.Gosched()
+		} else {
+			time.Sleep(time.Duration(rng.Int63n(int64(backoff))))
+			if backoff < time.Millisecond {
+				backoff *= 2
+			}
+		}
+	}
+}
+
+type global struct{}
+
+func (global) Name() string { return "global" }
+
+func (global) transfer(b *Bank, from, to *Account, amount int64, rng *rand.Rand) (bool, int) {
+	b.global.Lock()
+	ok := b.move(from, to, amount)
+	b.global.Unlock()
+	return ok, 0
+}
+
+// ==============================
+// Simulation
+// ==============================
+
+// Config describes one run.
+type Config struct {
+	Accounts  int           // defaults to 10
+	Initial   int64         // starting balance of every account; defaults to 1000
+	MaxAmount int64         // transfers are 1..MaxAmount; defaults to 100
+	Workers   int           // goroutines making transfers; defaults to 8
+	Duration  time.Duration // defaults to 500ms
+	// Hold is how long a transfer keeps its locks, standing in for the work a
+	// real transfer does inside them. With Hold at 0 the critical section is
+	// a few nanoseconds and the cheapest lock wins; with a real Hold, how
+	// many transfers can run at once matters more.
+	Hold     time.Duration
+	Strategy Strategy
+	Seed     int64
+}
+
+func (c *Config) setDefaults() {
+	if c.Accounts < 2 {
+		c.Accounts = 10
+	}
+	if c.Initial <= 0 {
+		c.Initial = 1000
+	}
+	if c.MaxAmount <= 0 {
+		c.MaxAmount = 100
+	}
+	if c.Workers < 1 {
+		c.Workers = 8
+	}
+	if c.Duration <= 0 {
+		c.Duration = 500 * time.Millisecond
+	}
+	if c.Strategy == nil {
+		c.Strategy = Ordered
+	}
+}
+
+// Report is what Run measured.
+type Report struct {
+	Strategy  string
+	Transfers int64 // completed transfers
+	Refused   int64 // transfers refused for insufficient funds
+	Retries   int64 // try-lock restarts
+	Audits    int   // audits made while transfers were running
+	Want, Got int64 // expected and final total
+	Conserved bool  // every audit and the final total matched
+	Elapsed   time.Duration
+}
+
+// PerSecond returns the transfer throughput, refused transfers included.
+func (r Report) PerSecond() float64 {
+	return float64(r.Transfers+r.Refused) / r.Elapsed.Seconds()
+}
+
+// Run makes random transfers from cfg.Workers goroutines for cfg.Duration
+// while an auditor checks the total every few milliseconds.
+func Run(cfg Config) Report {
+	cfg.setDefaults()
+	b := New(cfg.Accounts, cfg.Initial)
+	b.hold = cfg.Hold
+	r := Report{Strategy: cfg.Strategy.Name(), Want: int64(cfg.Accounts) * cfg.Initial, Conserved: true}
+
+	var stop int32
+	var wg sync.WaitGroup
+	start := time.Now()
+	for w := 0; w < cfg.Workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(cfg.Seed + int64(w)))
+			var done, refused, retries int64
+			for atomic.LoadInt32(&stop) == 0 {
+				from := rng.Intn(cfg.Accounts)
+				to := rng.Intn(cfg.Accounts - 1)
+				if to >= from {
+					to++ // never the same account
+				}
+				ok, n := cfg.Strategy.transfer(b, b.accounts[from], b.accounts[to], 1+rng.Int63n(cfg.MaxAmount), rng)
+				if ok {
+					done++
+				} else {
+					refused++
+				}
+				retries += int64(n)
+			}
+			atomic.AddInt64(&r.Transfers, done)
+			atomic.AddInt64(&r.Refused, refused)
+			atomic.AddInt64(&r.Retries, retries)
+		}(w)
+	}
+
+	// The auditor runs alongside the transfers.
+	for deadline := start.Add(cfg.Duration); time.Now().Before(deadline); {
+		time.Sleep(5 * time.Millisecond)
+		if b.Audit() != r.Want {
+			r.Conserved = false
+		}
+		r.Audits++
+	}
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	r.Elapsed = time.Since(start)
+	r.Got = b.Audit()
+	if r.Got != r.Want {
+		r.Conserved = false
+	}
+	return r
+}
+
+// ==============================
+// Example
+// ==============================
+
+// TestBankTransfers runs every strategy with an empty critical section, then
+// with 100µs of work inside the locks on few accounts (heavy contention) and
+// on many. bank_test.go checks under -race that every strategy conserves
+// the money.
+func TestBankTransfers() {
+	cases := []struct {
+		accounts int
+		hold     time.Duration
+	}{
+		{1000, 0},
+		{4, 100 * time.Microsecond},
+		{1000, 100 * time.Microsecond},
+	}
+	for _, c := range cases {
+		fmt.Printf("%d accounts, 8 workers, %v inside the locks:\n", c.accounts, c.hold)
+		fmt.Printf("  %-9s %12s %9s %9s %7s  %s\n", "strategy", "transfers/s", "refused", "retries", "audits", "money")
+		for _, s := range Strategies {
+			r := Run(Config{Accounts: c.accounts, Hold: c.hold, Strategy: s, Duration: 300 * time.Millisecond, Seed: 1})
+			money := fmt.Sprintf("conserved (%d)", r.Got)
+			if !r.Conserved {
+				money = fmt.Sprintf("NOT conserved: want %d, got %d", r.Want, r.Got)
+			}
+			fmt.Printf("  %-9s %12.0f %9d %9d %7d  %s\n", r.Strategy, r.PerSecond(), r.Refused, r.Retries, r.Audits, money)
+		}
+	}
+	// Example Output (numbers vary by machine):
+	// 1000 accounts, 8 workers, 0s inside the locks:
+	//   strategy   transfers/s   refused   retries  audits  money
+	//   ordered       13985738    212281         0      16  conserved (1000000)
+	//   try-lock      13145503    193338        60      15  conserved (1000000)
+	//   global        16095565    256953         0      13  conserved (1000000)
+	// 4 accounts, 8 workers, 100µs inside the locks:
+	//   strategy   transfers/s   refused   retries  audits  money
+	//   ordered           1047         6         0      18  conserved (4000)
+	//   try-lock          1276         8      1513      36  conserved (4000)
+	//   global             820         6         0      22  conserved (4000)
+	// 1000 accounts, 8 workers, 100µs inside the locks:
+	//   strategy   transfers/s   refused   retries  audits  money
+	//   ordered           4889         0         0      28  conserved (1000000)
+	//   try-lock          4499         0       520      30  conserved (1000000)
+	//   global             856         0         0      22  conserved (1000000)
+	//
+	// Tradeoffs:
+	// - With nothing to do inside the locks, the global lock is fastest: one
+	//   lock is cheaper than two, and there is nothing to overlap.
+	// - With real work inside, the global lock runs one transfer at a time,
+	//   whatever the number of accounts. Per-account locks let transfers on
+	//   different accounts overlap, so they scale with the number of accounts.
+	// - Try-lock keeps up with ordered locking, but pays in retries when few
+	//   accounts are busy; ordered locking needs no retries at all, only the
+	//   discipline to sort.
+}
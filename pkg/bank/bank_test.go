@@ -0,0 +1,34 @@
+// bank_test.go
+//
+// Tests for the transfer strategies. Run them under the race detector to
+// have it check the locking as well:
+//
+//	go test -race ./pkg/bank
+
+package bank
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunConservesMoney(t *testing.T) {
+	for _, s := range Strategies {
+		t.Run(s.Name(), func(t *testing.T) {
+			r := Run(Config{
+				Accounts: 4,
+				Workers:  8,
+				Duration: 50 * time.Millisecond,
+				Hold:     10 * time.Microsecond,
+				Strategy: s,
+				Seed:     1,
+			})
+			if !r.Conserved || r.Got != r.Want {
+				t.Fatalf("money not conserved: want %d, got %d (conserved=%v)", r.Want, r.Got, r.Conserved)
+			}
+			if r.Transfers == 0 {
+				t.Fatal("no transfers completed")
+			}
+		})
+	}
+}
@@ -0,0 +1,469 @@
+// channels.go
+//
+// This package provides generic channel combinators for building pipelines:
+// cancellation (OrDone), duplication (Tee), flattening (Bridge), grouping
+// (Batch), rate shaping (Debounce, Throttle) and buffering with an overflow
+// policy (Buffer).
+
+package channels
+
+import (
+	"fmt"
+	"time"
+
+	"Golan-Concepts/pkg/clock"
+)
+
+// ==============================
+// Conventions
+// ==============================
+//
+// Every function here starts one goroutine that reads from an input channel
+// and writes to an output channel it owns:
+//
+// 1. The output channel is closed when the input is closed or done is closed,
+//    so callers can always range over it.
+// 2. Every send and receive also selects on done, so closing done stops the
+//    goroutine even if nobody reads the output any more. This is what
+//    prevents the leak that pkg/leakcheck finds in generatorWithBoring
+//    when its coordinator is never shut down.
+//
+// done is a <-chan struct{}, like Generator's quit channel; pass ctx.Done()
+// to drive it with a context.
+
+// OrDone returns a channel with the values of c that stops when done is
+// closed. It turns
+//
+//	for {
+//	    select {
+//	    case <-done:
+//	        return
+//	    case v, ok := <-c:
+//	        if !ok { return }
+//	        ...
+//	    }
+//	}
+//
+// into `for v := range OrDone(done, c) { ... }`.
+func OrDone[T any](done <-chan struct{}, c <-chan T) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case <-done:
+				return
+			case v, ok := <-c:
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Tee sends every value of in to both outputs. Each value is delivered to
+// both before the next is read, so the slower reader sets the pace.
+func Tee[T any](done <-chan struct{}, in <-chan T) (<-chan T, <-chan T) {
+	out1, out2 := make(chan T), make(chan T)
+	go func() {
+		defer close(out1)
+		defer close(out2)
+		for v := range OrDone(done, in) {
+			// Local copies: setting one to nil once it has the value makes
+			// the select pick the other one next.
+			o1, o2 := out1, out2
+			for i := 0; i < 2; i++ {
+				select {
+				case <-done:
+					return
+				case o1 <- v:
+					o1 = nil
+				case o2 <- v:
+					o2 = nil
+				}
+			}
+		}
+	}()
+	return out1, out2
+}
+
+// Bridge flattens a channel of channels: it reads each inner channel to the
+// end, in order, and forwards its values.
+func Bridge[T any](done <-chan struct{}, chans <-chan (<-chan T)) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		for c := range OrDone(done, chans) {
+			for v := range OrDone(done, c) {
+				select {
+				case out <- v:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// ==============================
+// Time-Based Combinators
+// ==============================
+//
+// The exported functions use the wall clock. Each one is a thin wrapper
+// around an unexported version that takes a clock.Clock, which the tests
+// drive with a clock.Fake.
+
+// Batch groups values into slices of up to size values. A batch is sent when
+// it is full, or maxWait after its first value arrived, whichever comes first;
+// a partial batch is sent when in is closed.
+func Batch[T any](done <-chan struct{}, in <-chan T, size int, maxWait time.Duration) <-chan []T {
+	return batch(clock.Real, done, in, size, maxWait)
+}
+
+func batch[T any](clk clock.Clock, done <-chan struct{}, in <-chan T, size int, maxWait time.Duration) <-chan []T {
+	out := make(chan []T)
+	go func() {
+		defer close(out)
+		var batch []T
+		var deadline <-chan time.Time // nil (blocks forever) while the batch is empty
+		flush := func() bool {
+			if len(batch) == 0 {
+				return true
+			}
+			select {
+			case out <- batch:
+			case <-done:
+				return false
+			}
+			batch, deadline = nil, nil
+			return true
+		}
+		for {
+			select {
+			case <-done:
+				return
+			case v, ok := <-in:
+				if !ok {
+					flush()
+					return
+				}
+				if len(batch) == 0 {
+					deadline = clk.After(maxWait)
+				}
+				batch = append(batch, v)
+				if len(batch) >= size && !flush() {
+					return
+				}
+			case <-deadline:
+				if !flush() {
+					return
+				}
+			}
+		}
+	}()
+	return out
+}
+
+// Debounce sends a value only after in has been quiet for the given period,
+// and then only the latest one. Use it for bursts where only the final state
+// matters, like keystrokes in a search box or file-change events.
+func Debounce[T any](done <-chan struct{}, in <-chan T, quiet time.Duration) <-chan T {
+	return debounce(clock.Real, done, in, quiet)
+}
+
+func debounce[T any](clk clock.Clock, done <-chan struct{}, in <-chan T, quiet time.Duration) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var latest T
+		// A fresh deadline for every value; the ones it replaces fire into
+		// channels nobody reads. nil while nothing is pending.
+		var deadline <-chan time.Time
+		for {
+			select {
+			case <-done:
+				return
+			case v, ok := <-in:
+				if !ok {
+					if deadline != nil {
+						select {
+						case out <- latest:
+						case <-done:
+						}
+					}
+					return
+				}
+				latest, deadline = v, clk.After(quiet)
+			case <-deadline:
+				select {
+				case out <- latest:
+				case <-done:
+					return
+				}
+				deadline = nil
+			}
+		}
+	}()
+	return out
+}
+
+// Throttle sends at most one value per interval: the first value goes through
+// at once, and values arriving in the following interval are dropped. To slow
+// a stream down without dropping anything, read it in step with a time.Ticker
+// instead.
+func Throttle[T any](done <-chan struct{}, in <-chan T, interval time.Duration) <-chan T {
+	return throttle(clock.Real, done, in, interval, nil)
+}
+
+// throttle is Throttle on clk. onDrop, if not nil, is called with every
+// dropped value.
+func throttle[T any](clk clock.Clock, done <-chan struct{}, in <-chan T, interval time.Duration, onDrop func(T)) <-chan T {
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var last time.Time
+		for v := range OrDone(done, in) {
+			now := clk.Now()
+			if !last.IsZero() && now.Sub(last) < interval {
+				if onDrop != nil {
+					onDrop(v)
+				}
+				continue
+			}
+			last = now
+			select {
+			case out <- v:
+			case <-done:
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// ==============================
+// Buffering
+// ==============================
+//
+// A buffered channel blocks the sender when it is full. That backpressure is
+// usually right, but not for a producer that must never stall, such as a
+// metrics or log pipeline. Buffer decouples the two sides and lets the caller
+// choose what happens when the reader falls behind.
+
+// OverflowPolicy decides what Buffer does when it is full.
+type OverflowPolicy int
+
+const (
+	Block      OverflowPolicy = iota // wait for room, like a buffered channel
+	DropNewest                       // discard the incoming value
+	DropOldest                       // discard the oldest buffered value to make room
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case DropNewest:
+		return "drop-newest"
+	case DropOldest:
+		return "drop-oldest"
+	default:
+		return "block"
+	}
+}
+
+// Buffer holds up to size values between in and the returned channel,
+// applying policy when it is full. onDrop, if not nil, is called with every
+// discarded value. Remaining values are delivered after in is closed.
+func Buffer[T any](done <-chan struct{}, in <-chan T, size int, policy OverflowPolicy, onDrop func(T)) <-chan T {
+	if size < 1 {
+		size = 1
+	}
+	out := make(chan T)
+	go func() {
+		defer close(out)
+		var queue []T
+		for in != nil || len(queue) > 0 {
+			// Disable a case by leaving its channel nil: no receiving when
+			// full under Block, no sending when empty.
+			var recv <-chan T = in
+			if policy == Block && len(queue) >= size {
+				recv = nil
+			}
+			var send chan<- T
+			var next T
+			if len(queue) > 0 {
+				send, next = out, queue[0]
+			}
+
+			select {
+			case <-done:
+				return
+			case v, ok := <-recv:
+				if !ok {
+					in = nil
+					continue
+				}
+				switch {
+				case len(queue) < size:
+					queue = append(queue, v)
+				case policy == DropOldest:
+					if onDrop != nil {
+						onDrop(queue[0])
+					}
+					queue = append(queue[1:], v)
+				default: // DropNewest
+					if onDrop != nil {
+						onDrop(v)
+					}
+				}
+			case send <- next:
+				queue = queue[1:]
+			}
+		}
+	}()
+	return out
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// emit is a small generator: it sends the values with the given pause
+// between them, then closes the channel.
+func emit[T any](done <-chan struct{}, pause time.Duration, values ...T) <-chan T {
+	c := make(chan T)
+	go func() {
+		defer close(c)
+		for _, v := range values {
+			select {
+			case c <- v:
+			case <-done:
+				return
+			}
+			time.Sleep(pause)
+		}
+	}()
+	return c
+}
+
+// TestChannelUtils runs every combinator on a small stream.
+func TestChannelUtils() {
+	done := make(chan struct{})
+	defer close(done)
+
+	// OrDone: stop reading an endless stream by closing done.
+	stop := make(chan struct{})
+	endless := make(chan int)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case endless <- i:
+			case <-stop:
+				return
+			}
+		}
+	}()
+	var first []int
+	quit := make(chan struct{})
+	for v := range OrDone(quit, endless) {
+		// OrDone may already hold the next value and deliver it before it
+		// sees quit, so only keep the first three. The loop ends when OrDone
+		// closes its output.
+		if len(first) < 3 {
+			first = append(first, v)
+			if len(first) == 3 {
+				close(quit)
+			}
+		}
+	}
+	close(stop)
+	fmt.Println("OrDone:", first, "then closed")
+
+	// Tee: both readers see every value.
+	a, b := Tee(done, emit(done, 0, 1, 2, 3))
+	for i := 0; i < 3; i++ {
+		fmt.Println("Tee:", <-a, <-b)
+	}
+
+	// Bridge: three generators read one after another.
+	chans := make(chan (<-chan string))
+	go func() {
+		defer close(chans)
+		for _, word := range []string{"ping", "pong", "done"} {
+			chans <- emit(done, 0, word+"1", word+"2")
+		}
+	}()
+	var bridged []string
+	for v := range Bridge(done, chans) {
+		bridged = append(bridged, v)
+	}
+	fmt.Println("Bridge:", bridged)
+
+	// Batch: 7 values arriving every 10ms, batches of 3 or 25ms.
+	for batch := range Batch(done, emit(done, 10*time.Millisecond, 1, 2, 3, 4, 5, 6, 7), 3, 25*time.Millisecond) {
+		fmt.Println("Batch:", batch)
+	}
+
+	// Debounce: a burst of keystrokes, then a pause, then another burst.
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		for _, k := range []string{"g", "go", "gol", "", "gola", "golan"} {
+			if k == "" {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			keys <- k
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	for q := range Debounce(done, keys, 50*time.Millisecond) {
+		fmt.Println("Debounce: search for", q)
+	}
+
+	// Throttle: 10 events 10ms apart, at most one per 35ms.
+	var throttled []int
+	for v := range Throttle(done, emit(done, 10*time.Millisecond, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9), 35*time.Millisecond) {
+		throttled = append(throttled, v)
+	}
+	fmt.Println("Throttle:", throttled)
+
+	// Buffer: a fast producer, a slow reader, room for 3.
+	for _, policy := range []OverflowPolicy{Block, DropNewest, DropOldest} {
+		dropped := 0
+		in := make(chan int)
+		go func() {
+			defer close(in)
+			for i := 1; i <= 10; i++ {
+				in <- i
+			}
+		}()
+		var got []int
+		for v := range Buffer(done, in, 3, policy, func(int) { dropped++ }) {
+			got = append(got, v)
+			time.Sleep(5 * time.Millisecond)
+		}
+		fmt.Printf("Buffer %-11s got %v, dropped %d\n", policy.String()+":", got, dropped)
+	}
+	// OrDone: [0 1 2] then closed
+	// Tee: 1 1
+	// Tee: 2 2
+	// Tee: 3 3
+	// Bridge: [ping1 ping2 pong1 pong2 done1 done2]
+	// Batch: [1 2 3]
+	// Batch: [4 5 6]
+	// Batch: [7]
+	// Debounce: search for gol
+	// Debounce: search for golan
+	// Throttle: [0 4 8]
+	// Buffer block:      got [1 2 3 4 5 6 7 8 9 10], dropped 0
+	// Buffer drop-newest: got [1 2 3 4], dropped 6
+	// Buffer drop-oldest: got [1 8 9 10], dropped 6
+}
@@ -0,0 +1,255 @@
+// channels_test.go
+//
+// Tests for the channel combinators. The time-based ones run on a
+// clock.Fake, so they check exact times instead of sleeping.
+
+package channels
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"Golan-Concepts/pkg/clock"
+	"Golan-Concepts/pkg/leakcheck"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// send sends v on c, failing t if nobody receives it within a second.
+func send[T any](t *testing.T, c chan<- T, v T) {
+	t.Helper()
+	select {
+	case c <- v:
+	case <-time.After(time.Second):
+		t.Fatalf("send of %v blocked", v)
+	}
+}
+
+// recv receives from c, failing t if nothing arrives within a second.
+func recv[T any](t *testing.T, c <-chan T) (T, bool) {
+	t.Helper()
+	select {
+	case v, ok := <-c:
+		return v, ok
+	case <-time.After(time.Second):
+		t.Fatal("receive blocked")
+		panic("unreachable")
+	}
+}
+
+// collect reads c until it is closed.
+func collect[T any](t *testing.T, c <-chan T) []T {
+	t.Helper()
+	var got []T
+	for {
+		v, ok := recv(t, c)
+		if !ok {
+			return got
+		}
+		got = append(got, v)
+	}
+}
+
+func TestOrDoneClosesWhenDoneCloses(t *testing.T) {
+	defer leakcheck.Verify(t, leakcheck.Options{})()
+
+	done := make(chan struct{})
+	in := make(chan int) // never closed
+	out := OrDone(done, in)
+	send(t, in, 1)
+	if v, _ := recv(t, out); v != 1 {
+		t.Fatalf("got %d, want 1", v)
+	}
+	close(done)
+	if v, ok := recv(t, out); ok {
+		t.Fatalf("got %d after done closed, want the output closed", v)
+	}
+}
+
+func TestTeeDeliversEveryValueToBoth(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 0; i < 100; i++ {
+			in <- i
+		}
+	}()
+	a, b := Tee(done, in)
+	gotB := make(chan []int)
+	go func() {
+		var got []int
+		for v := range b {
+			got = append(got, v)
+		}
+		gotB <- got
+	}()
+	var gotA []int
+	for v := range a {
+		gotA = append(gotA, v)
+	}
+	if len(gotA) != 100 || !reflect.DeepEqual(gotA, <-gotB) {
+		t.Fatalf("outputs differ or are short: %v", gotA)
+	}
+}
+
+func TestBridgeKeepsOrder(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	chans := make(chan (<-chan int))
+	go func() {
+		defer close(chans)
+		for i := 0; i < 3; i++ {
+			c := make(chan int, 3)
+			for j := 0; j < 3; j++ {
+				c <- i*3 + j
+			}
+			close(c)
+			chans <- c
+		}
+	}()
+	want := []int{0, 1, 2, 3, 4, 5, 6, 7, 8}
+	if got := collect(t, Bridge(done, chans)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestBatchFlushesBySizeAndMaxWait(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	fake := clock.NewFake(testStart)
+	in := make(chan int)
+	out := batch(fake, done, in, 3, 25*time.Millisecond)
+
+	// Three values at once fill a batch.
+	for i := 1; i <= 3; i++ {
+		send(t, in, i)
+	}
+	if got, _ := recv(t, out); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Fatalf("got %v, want [1 2 3]", got)
+	}
+
+	// The first batch's deadline (12:00:00.025) is pending still. A value at
+	// 10ms starts a new one, due at 35ms.
+	fake.Advance(10 * time.Millisecond)
+	send(t, in, 4)
+	fake.BlockUntil(2)
+	fake.Advance(15 * time.Millisecond) // the stale deadline must not flush
+	send(t, in, 5)                      // would block if [4] had been flushed
+	fake.Advance(10 * time.Millisecond)
+	if got, _ := recv(t, out); !reflect.DeepEqual(got, []int{4, 5}) {
+		t.Fatalf("got %v at 35ms, want [4 5]", got)
+	}
+
+	// Closing in flushes a partial batch.
+	send(t, in, 6)
+	close(in)
+	if got := collect(t, out); !reflect.DeepEqual(got, [][]int{{6}}) {
+		t.Fatalf("got %v after close, want [[6]]", got)
+	}
+}
+
+func TestDebounceSendsLatestAfterQuiet(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	fake := clock.NewFake(testStart)
+	in := make(chan string)
+	out := debounce(fake, done, in, 50*time.Millisecond)
+
+	// A burst 10ms apart: each value pushes the deadline back.
+	for i, v := range []string{"g", "go", "gol"} {
+		send(t, in, v)
+		fake.BlockUntil(i + 1)
+		fake.Advance(10 * time.Millisecond)
+	}
+	// "gol" arrived at 20ms and is due at 70ms. At 65ms only the deadlines
+	// of "g" and "go" have passed.
+	fake.Advance(35 * time.Millisecond)
+	send(t, in, "gola") // would block if debounce were sending "gol"
+	fake.BlockUntil(2)  // the deadlines of "gol" and "gola"
+	fake.Advance(50 * time.Millisecond)
+	if v, _ := recv(t, out); v != "gola" {
+		t.Fatalf("got %q, want %q", v, "gola")
+	}
+
+	// A value still pending when in closes is sent at once.
+	send(t, in, "golan")
+	close(in)
+	if got := collect(t, out); !reflect.DeepEqual(got, []string{"golan"}) {
+		t.Fatalf("got %v after close, want [golan]", got)
+	}
+}
+
+func TestThrottleDropsWithinInterval(t *testing.T) {
+	done := make(chan struct{})
+	defer close(done)
+
+	fake := clock.NewFake(testStart)
+	in := make(chan int)
+	dropped := make(chan int)
+	out := throttle(fake, done, in, 35*time.Millisecond, func(v int) { dropped <- v })
+
+	// Values every 10ms: one goes through, the next three fall inside its
+	// interval and are dropped.
+	for i := 0; i < 10; i++ {
+		send(t, in, i)
+		pass := i%4 == 0
+		select {
+		case v := <-out:
+			if !pass {
+				t.Fatalf("value %d went through, want it dropped", v)
+			}
+		case v := <-dropped:
+			if pass {
+				t.Fatalf("value %d was dropped, want it sent", v)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("value %d was neither sent nor dropped", i)
+		}
+		fake.Advance(10 * time.Millisecond)
+	}
+}
+
+func TestBufferOverflowPolicies(t *testing.T) {
+	cases := []struct {
+		policy  OverflowPolicy
+		want    []int
+		dropped []int
+	}{
+		{Block, []int{1, 2, 3, 4, 5}, nil},
+		{DropNewest, []int{1, 2, 3}, []int{4, 5}},
+		{DropOldest, []int{3, 4, 5}, []int{1, 2}},
+	}
+	for _, c := range cases {
+		t.Run(c.policy.String(), func(t *testing.T) {
+			done := make(chan struct{})
+			defer close(done)
+
+			// Nobody reads until the producer is done, so the buffer fills up.
+			in := make(chan int)
+			sent := make(chan struct{})
+			go func() {
+				defer close(sent)
+				defer close(in)
+				for i := 1; i <= 5; i++ {
+					in <- i
+				}
+			}()
+			var dropped []int
+			out := Buffer(done, in, 3, c.policy, func(v int) { dropped = append(dropped, v) })
+			if c.policy != Block { // under Block the producer waits for the reader
+				<-sent
+			}
+			got := collect(t, out)
+			if !reflect.DeepEqual(got, c.want) || !reflect.DeepEqual(dropped, c.dropped) {
+				t.Fatalf("got %v, dropped %v; want %v, dropped %v", got, dropped, c.want, c.dropped)
+			}
+		})
+	}
+}
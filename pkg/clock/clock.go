@@ -0,0 +1,201 @@
+// clock.go
+//
+// This package lets code that depends on time be tested without waiting:
+// production code uses the real clock, tests and demos use a fake clock that
+// only moves when told to.
+
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ==============================
+// Injectable Clocks
+// ==============================
+//
+// Code that calls time.Now, time.After or time.NewTicker directly is hard to
+// test: a test of a 30s timeout takes 30s, and a test of "what happens at
+// 11:59:59" cannot be written at all. The fix is to pass a Clock in:
+//
+//     type Aggregator struct { clock clock.Clock; ... }
+//
+//     agg := NewAggregator(clock.Real)        // production
+//     fake := clock.NewFake(start)            // test
+//     agg := NewAggregator(fake)
+//     fake.Advance(time.Minute)               // a minute passes, instantly
+//
+// Fake fires timers and tickers in order as Advance moves time past them,
+// so the outcome does not depend on how fast the machine is.
+
+// Clock is the subset of the time package that time-dependent code needs.
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	Sleep(d time.Duration)
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks on C until stopped, like *time.Ticker.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the wall clock, backed by the time package.
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ t *time.Ticker }
+
+func (r realTicker) C() <-chan time.Time { return r.t.C }
+func (r realTicker) Stop()               { r.t.Stop() }
+
+// ==============================
+// Fake Clock
+// ==============================
+
+// waiter is a pending After, Sleep or ticker on a Fake clock.
+type waiter struct {
+	when   time.Time
+	period time.Duration // 0 for one-shot waiters
+	ch     chan time.Time
+}
+
+// Fake is a manually driven clock. Create it with NewFake.
+type Fake struct {
+	mu      sync.Mutex
+	changed *sync.Cond // broadcast when waiters are added
+	now     time.Time
+	waiters []*waiter
+}
+
+// NewFake returns a fake clock set to start.
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.changed = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now returns the fake time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t.
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After returns a channel that receives the fake time once Advance has moved
+// it d forward.
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.add(d, 0).ch
+}
+
+// Sleep blocks until Advance has moved the fake time d forward.
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// NewTicker returns a ticker that ticks every d of fake time. Like a real
+// ticker, it drops ticks for a slow receiver.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return &fakeTicker{clock: f, w: f.add(d, d)}
+}
+
+type fakeTicker struct {
+	clock *Fake
+	w     *waiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.w.ch }
+func (t *fakeTicker) Stop()               { t.clock.remove(t.w) }
+
+func (f *Fake) add(d, period time.Duration) *waiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &waiter{when: f.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- f.now
+		return w
+	}
+	f.waiters = append(f.waiters, w)
+	f.changed.Broadcast()
+	return w
+}
+
+func (f *Fake) remove(w *waiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, other := range f.waiters {
+		if other == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Advance moves the fake time forward by d, firing every timer and ticker
+// that falls due on the way, in time order.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	end := f.now.Add(d)
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].when.Before(f.waiters[j].when) })
+		if len(f.waiters) == 0 || f.waiters[0].when.After(end) {
+			break
+		}
+		w := f.waiters[0]
+		f.now = w.when
+		select {
+		case w.ch <- w.when:
+		default: // receiver is behind: drop the tick, as time.Ticker does
+		}
+		if w.period > 0 {
+			w.when = w.when.Add(w.period)
+		} else {
+			f.waiters = f.waiters[1:]
+		}
+	}
+	f.now = end
+}
+
+// Set moves the fake time to t, firing what falls due. Moving backwards
+// only changes Now.
+func (f *Fake) Set(t time.Time) {
+	if d := t.Sub(f.Now()); d > 0 {
+		f.Advance(d)
+		return
+	}
+	f.mu.Lock()
+	f.now = t
+	f.mu.Unlock()
+}
+
+// BlockUntil waits until at least n timers, sleepers or tickers are pending.
+// Tests use it to make sure a goroutine has started waiting before they
+// call Advance.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.changed.Wait()
+	}
+}
@@ -0,0 +1,395 @@
+// concurrency-cond.go
+//
+// This file demonstrates sync.Cond by building three classic primitives on
+// it: a bounded ring buffer, a reusable cyclic barrier and a countdown latch.
+
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ==============================
+// sync.Cond
+// ==============================
+//
+// A mutex answers "may I touch this data?". A condition variable answers
+// "has the data reached the state I am waiting for?". sync.Cond pairs a
+// Locker with a queue of waiting goroutines:
+//
+//     cond := sync.NewCond(&mu)
+//
+//     mu.Lock()
+//     for !condition() {   // always a loop: wake-ups can be spurious or stale
+//         cond.Wait()      // atomically unlocks mu, sleeps, re-locks mu on wake-up
+//     }
+//     ... use the data ...
+//     mu.Unlock()
+//
+// and whoever changes the state wakes the waiters:
+//
+//     cond.Signal()        // wake one waiter
+//     cond.Broadcast()     // wake all waiters
+//
+// Channels cover most of these needs in Go, and the demos below compare each
+// primitive with its channel equivalent. sync.Cond is still the right tool
+// when many goroutines wait on an arbitrary condition over shared state.
+//
+// One limitation: Cond.Wait cannot be cancelled. waitCond works around it by
+// broadcasting from a helper goroutine when the context is done.
+
+// ErrClosed is returned by operations on a closed BoundedBuffer.
+var ErrClosed = errors.New("buffer closed")
+
+// waitCond waits on cond until ready returns true or ctx is done. The caller
+// must hold cond.L; it is still held when waitCond returns.
+func waitCond(ctx context.Context, cond *sync.Cond, ready func() bool) error {
+	if ready() {
+		return nil
+	}
+	if ctx.Done() == nil {
+		// context.Background() and friends are never cancelled: a plain Wait loop is enough.
+		for !ready() {
+			cond.Wait()
+		}
+		return nil
+	}
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			cond.L.Lock()
+			cond.Broadcast()
+			cond.L.Unlock()
+		case <-stop:
+		}
+	}()
+	for !ready() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		cond.Wait()
+	}
+	return nil
+}
+
+// ==============================
+// 1. Bounded Ring Buffer
+// ==============================
+//
+// Two condition variables share one mutex: producers wait on notFull,
+// consumers wait on notEmpty. Each side signals the other after changing the
+// buffer. This is what a buffered channel does internally.
+
+// BoundedBuffer is a fixed-capacity FIFO queue. Create it with NewBoundedBuffer.
+type BoundedBuffer[T any] struct {
+	mu       sync.Mutex
+	notFull  *sync.Cond
+	notEmpty *sync.Cond
+	items    []T
+	head     int
+	count    int
+	closed   bool
+}
+
+// NewBoundedBuffer returns an empty buffer holding at most capacity items.
+func NewBoundedBuffer[T any](capacity int) *BoundedBuffer[T] {
+	if capacity < 1 {
+		capacity = 1
+	}
+	b := &BoundedBuffer[T]{items: make([]T, capacity)}
+	b.notFull = sync.NewCond(&b.mu)
+	b.notEmpty = sync.NewCond(&b.mu)
+	return b
+}
+
+// Put adds v, waiting while the buffer is full.
+func (b *BoundedBuffer[T]) Put(ctx context.Context, v T) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := waitCond(ctx, b.notFull, func() bool { return b.closed || b.count < len(b.items) }); err != nil {
+		return err
+	}
+	if b.closed {
+		return ErrClosed
+	}
+	b.items[(b.head+b.count)%len(b.items)] = v
+	b.count++
+	b.notEmpty.Signal()
+	return nil
+}
+
+// Get removes and returns the oldest item, waiting while the buffer is empty.
+// After Close, remaining items are still returned; then Get returns ErrClosed.
+func (b *BoundedBuffer[T]) Get(ctx context.Context) (T, error) {
+	var zero T
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := waitCond(ctx, b.notEmpty, func() bool { return b.closed || b.count > 0 }); err != nil {
+		return zero, err
+	}
+	if b.count == 0 {
+		return zero, ErrClosed
+	}
+	v := b.items[b.head]
+	b.items[b.head] = zero
+	b.head = (b.head + 1) % len(b.items)
+	b.count--
+	b.notFull.Signal()
+	return v, nil
+}
+
+// Len returns the number of buffered items.
+func (b *BoundedBuffer[T]) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
+
+// Close wakes every waiter. Put fails from now on; Get drains what is left.
+func (b *BoundedBuffer[T]) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	b.notFull.Broadcast()
+	b.notEmpty.Broadcast()
+}
+
+// ==============================
+// 2. Cyclic Barrier
+// ==============================
+//
+// A barrier makes N goroutines wait for each other: nobody continues until all
+// N have arrived. It is cyclic because it resets itself and can be reused for
+// the next phase. The generation number tells a waiter that its phase is over,
+// even if the next phase has already started filling up again.
+
+// CyclicBarrier is a reusable barrier for n goroutines. Create it with
+// NewCyclicBarrier.
+type CyclicBarrier struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	parties    int
+	arrived    int
+	generation int
+	action     func()
+}
+
+// NewCyclicBarrier returns a barrier for n goroutines. If action is not nil,
+// the last goroutine to arrive runs it before the others are released.
+// It panics if n < 1: no goroutine could ever complete a phase.
+func NewCyclicBarrier(n int, action func()) *CyclicBarrier {
+	if n < 1 {
+		panic(fmt.Sprintf("concurrency: NewCyclicBarrier with %d parties", n))
+	}
+	b := &CyclicBarrier{parties: n, action: action}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Await blocks until all parties have called Await. A goroutine whose
+// context is done withdraws from the current phase, so the barrier stays
+// usable for the others.
+func (b *CyclicBarrier) Await(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	gen := b.generation
+	b.arrived++
+	if b.arrived == b.parties {
+		if b.action != nil {
+			b.action()
+		}
+		b.arrived = 0
+		b.generation++
+		b.cond.Broadcast()
+		return nil
+	}
+
+	if err := waitCond(ctx, b.cond, func() bool { return b.generation != gen }); err != nil {
+		b.arrived--
+		return err
+	}
+	return nil
+}
+
+// ==============================
+// 3. Countdown Latch
+// ==============================
+//
+// A latch opens once: it starts at N, goroutines count it down, and everybody
+// waiting is released when it reaches zero. Unlike a WaitGroup, the waiters and
+// the counters are usually different goroutines, and counting past zero is harmless.
+
+// CountDownLatch is a one-shot gate. Create it with NewCountDownLatch.
+type CountDownLatch struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	count int
+}
+
+// NewCountDownLatch returns a latch that opens after n calls to CountDown; a
+// latch for 0 is open from the start. It panics if n < 0: CountDown stops at
+// zero, so the latch could never open.
+func NewCountDownLatch(n int) *CountDownLatch {
+	if n < 0 {
+		panic(fmt.Sprintf("concurrency: NewCountDownLatch with count %d", n))
+	}
+	l := &CountDownLatch{count: n}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+// CountDown decrements the count, releasing all waiters when it reaches zero.
+func (l *CountDownLatch) CountDown() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.count == 0 {
+		return
+	}
+	l.count--
+	if l.count == 0 {
+		l.cond.Broadcast()
+	}
+}
+
+// Count returns the remaining count.
+func (l *CountDownLatch) Count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.count
+}
+
+// Wait blocks until the count reaches zero or ctx is done.
+func (l *CountDownLatch) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return waitCond(ctx, l.cond, func() bool { return l.count == 0 })
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// TestBoundedBuffer moves the same items through a BoundedBuffer and a
+// buffered channel of the same capacity.
+func TestBoundedBuffer() {
+	const items = 100000
+	ctx := context.Background()
+
+	buf := NewBoundedBuffer[int](16)
+	start := time.Now()
+	go func() {
+		for i := 0; i < items; i++ {
+			buf.Put(ctx, i)
+		}
+		buf.Close()
+	}()
+	sum := 0
+	for {
+		v, err := buf.Get(ctx)
+		if err != nil {
+			break
+		}
+		sum += v
+	}
+	fmt.Printf("BoundedBuffer: sum=%d in %v\n", sum, time.Since(start))
+
+	ch := make(chan int, 16)
+	start = time.Now()
+	go func() {
+		for i := 0; i < items; i++ {
+			ch <- i
+		}
+		close(ch)
+	}()
+	sum = 0
+	for v := range ch {
+		sum += v
+	}
+	fmt.Printf("chan:          sum=%d in %v\n", sum, time.Since(start))
+	// Both sums are 4999950000. The channel is usually faster: the runtime
+	// hands values directly to a waiting receiver instead of waking it to re-check.
+
+	// Only the cond-based buffer lets a waiting consumer give up:
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err := NewBoundedBuffer[int](1).Get(timeout)
+	fmt.Println("Get on empty buffer:", err) // context deadline exceeded
+}
+
+// TestCyclicBarrier runs three workers through three phases. No worker starts
+// a phase before all have finished the previous one. The channel equivalent
+// needs a fresh WaitGroup (or channel) per phase, created by a coordinator.
+func TestCyclicBarrier() {
+	const workers, phases = 3, 3
+	barrier := NewCyclicBarrier(workers, func() { fmt.Println("--- phase complete ---") })
+
+	var wg sync.WaitGroup
+	for w := 1; w <= workers; w++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for phase := 1; phase <= phases; phase++ {
+				time.Sleep(time.Duration(id*10) * time.Millisecond)
+				fmt.Printf("worker %d finished phase %d\n", id, phase)
+				barrier.Await(context.Background())
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	// Channel/WaitGroup version: the coordinator drives each phase.
+	for phase := 1; phase <= phases; phase++ {
+		var phaseWG sync.WaitGroup
+		for w := 1; w <= workers; w++ {
+			phaseWG.Add(1)
+			go func(id int) {
+				defer phaseWG.Done()
+				time.Sleep(time.Duration(id*10) * time.Millisecond)
+			}(w)
+		}
+		phaseWG.Wait()
+		fmt.Printf("coordinator: phase %d complete\n", phase)
+	}
+}
+
+// TestCountDownLatch starts workers that all wait for a single "go" signal.
+// Closing a channel is the idiomatic channel equivalent of a latch of one.
+func TestCountDownLatch() {
+	ready := NewCountDownLatch(3)
+	start := NewCountDownLatch(1)
+	var wg sync.WaitGroup
+
+	for i := 1; i <= 3; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			ready.CountDown()
+			start.Wait(context.Background())
+			fmt.Printf("runner %d: go!\n", id)
+		}(i)
+	}
+	ready.Wait(context.Background())
+	fmt.Println("all runners ready")
+	start.CountDown()
+	wg.Wait()
+
+	// Channel version of the start gate.
+	gate := make(chan struct{})
+	for i := 1; i <= 3; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			<-gate
+			fmt.Printf("runner %d: go! (channel)\n", id)
+		}(i)
+	}
+	close(gate)
+	wg.Wait()
+}
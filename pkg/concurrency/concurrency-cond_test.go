@@ -0,0 +1,186 @@
+// concurrency-cond_test.go
+//
+// Tests for the condition-variable types in concurrency-cond.go.
+
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBoundedBufferFIFO(t *testing.T) {
+	ctx := context.Background()
+	b := NewBoundedBuffer[int](3)
+	for round := 0; round < 3; round++ { // wraps around the ring
+		for i := 0; i < 3; i++ {
+			if err := b.Put(ctx, round*3+i); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+		}
+		for i := 0; i < 3; i++ {
+			if v, err := b.Get(ctx); err != nil || v != round*3+i {
+				t.Fatalf("Get = %d, %v; want %d", v, err, round*3+i)
+			}
+		}
+	}
+}
+
+func TestBoundedBufferWaitsAndGivesUp(t *testing.T) {
+	b := NewBoundedBuffer[int](1)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.Get(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Get on empty buffer = %v, want DeadlineExceeded", err)
+	}
+	b.Put(context.Background(), 1)
+	if err := b.Put(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Put on full buffer = %v, want DeadlineExceeded", err)
+	}
+	if n := b.Len(); n != 1 {
+		t.Fatalf("Len = %d, want 1", n)
+	}
+}
+
+func TestBoundedBufferClose(t *testing.T) {
+	ctx := context.Background()
+	b := NewBoundedBuffer[int](2)
+	b.Put(ctx, 1)
+
+	got := make(chan error)
+	go func() {
+		b.Get(ctx)           // takes 1
+		_, err := b.Get(ctx) // waits until Close
+		got <- err
+	}()
+	time.Sleep(10 * time.Millisecond) // usually long enough for the second Get to wait
+	b.Close()
+	if err := <-got; !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get after Close = %v, want ErrClosed", err)
+	}
+	if err := b.Put(ctx, 2); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Put after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestBoundedBufferProducersConsumers(t *testing.T) {
+	const producers, items = 4, 1000
+	ctx := context.Background()
+	b := NewBoundedBuffer[int](8)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 1; i <= items; i++ {
+				b.Put(ctx, i)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		b.Close()
+	}()
+
+	sums := make(chan int)
+	for c := 0; c < 3; c++ {
+		go func() {
+			sum := 0
+			for {
+				v, err := b.Get(ctx)
+				if err != nil {
+					sums <- sum
+					return
+				}
+				sum += v
+			}
+		}()
+	}
+	total := <-sums + <-sums + <-sums
+	if want := producers * items * (items + 1) / 2; total != want {
+		t.Fatalf("consumers got a total of %d, want %d", total, want)
+	}
+}
+
+func TestCountDownLatchOpensOnce(t *testing.T) {
+	l := NewCountDownLatch(3)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait before CountDown = %v, want DeadlineExceeded", err)
+	}
+
+	released := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { released <- l.Wait(context.Background()) }()
+	}
+	for i := 0; i < 5; i++ { // counting past zero is harmless
+		l.CountDown()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-released; err != nil {
+			t.Fatalf("Wait = %v, want nil", err)
+		}
+	}
+	if n := l.Count(); n != 0 {
+		t.Fatalf("Count = %d, want 0", n)
+	}
+	if err := NewCountDownLatch(0).Wait(ctx); err != nil {
+		t.Fatalf("Wait on a latch for 0 = %v, want nil", err)
+	}
+}
+
+func TestNewCountDownLatchRejectsNegativeCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("NewCountDownLatch(-1) did not panic")
+		}
+	}()
+	NewCountDownLatch(-1)
+}
+
+func TestNewCyclicBarrierRejectsNoParties(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewCyclicBarrier(%d) did not panic", n)
+				}
+			}()
+			NewCyclicBarrier(n, nil)
+		}()
+	}
+}
+
+func TestCyclicBarrierPhases(t *testing.T) {
+	const parties, phases = 4, 3
+	var mu sync.Mutex
+	completed := 0
+	b := NewCyclicBarrier(parties, func() {
+		mu.Lock()
+		completed++
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < parties; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := 0; p < phases; p++ {
+				if err := b.Await(context.Background()); err != nil {
+					t.Errorf("Await: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if completed != phases {
+		t.Fatalf("action ran %d times, want %d", completed, phases)
+	}
+}
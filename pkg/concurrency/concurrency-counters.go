@@ -0,0 +1,319 @@
+// concurrency-counters.go
+//
+// This file demonstrates a family of concurrent counters behind a single
+// Counter interface. concurrency-counters_test.go benchmarks how each one
+// scales with GOMAXPROCS.
+
+package concurrency
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// ==============================
+// Why One Counter Is Not Enough
+// ==============================
+//
+// SafeCounter (here and in pkg/func) and the global atomicCounter are correct,
+// but every increment from every goroutine touches the same memory location.
+// On a multi-core machine that location's cache line bounces between cores,
+// so adding more goroutines makes each increment slower, not faster.
+//
+// The counters below trade a little read cost or accuracy for write throughput:
+//
+// | Counter        | Local().Add                      | Value                |
+// |----------------|----------------------------------|----------------------|
+// | MutexCounter   | lock + increment                 | lock + read          |
+// | AtomicCounter  | one atomic add, shared line      | one atomic load      |
+// | StripedCounter | atomic add on the adder's stripe | sum of all stripes   |
+// | BatchedCounter | plain add, flush every N         | flushed total only   |
+//
+// The fast counters need per-goroutine state: a stripe, or a pending count.
+// Every counter has a plain Add that works from any goroutine, but for the
+// striped and batched counters it is no faster than AtomicCounter. A
+// goroutine that writes a lot gets an Adder from LocalAdder instead and keeps
+// it for as long as it writes.
+
+// Counter is implemented by every counter in this file.
+type Counter interface {
+	Add(delta int64)
+	Value() int64
+	Reset()
+}
+
+// Localizer is implemented by counters with a faster per-goroutine write
+// path.
+type Localizer interface {
+	// Local returns an Adder for the calling goroutine. It must not be
+	// shared, and Flush must be called when the goroutine is done writing.
+	Local() Adder
+}
+
+// Adder adds to a Counter on behalf of one goroutine.
+type Adder interface {
+	Add(delta int64)
+	Flush() // publish anything still pending
+}
+
+// LocalAdder returns c's Local Adder if c is a Localizer, and otherwise an
+// Adder that calls c.Add.
+func LocalAdder(c Counter) Adder {
+	if l, ok := c.(Localizer); ok {
+		return l.Local()
+	}
+	return direct(c.Add)
+}
+
+// direct is the Adder of a counter that publishes every Add at once.
+type direct func(delta int64)
+
+func (d direct) Add(delta int64) { d(delta) }
+func (direct) Flush()            {}
+
+// ==============================
+// 1. Mutex Counter
+// ==============================
+
+// MutexCounter is SafeCounter with the Counter interface.
+type MutexCounter struct {
+	mu    sync.Mutex
+	value int64
+}
+
+// Add adds delta to the counter.
+func (c *MutexCounter) Add(delta int64) {
+	c.mu.Lock()
+	c.value += delta
+	c.mu.Unlock()
+}
+
+// Value returns the current count.
+func (c *MutexCounter) Value() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value
+}
+
+// Reset sets the counter back to zero.
+func (c *MutexCounter) Reset() {
+	c.mu.Lock()
+	c.value = 0
+	c.mu.Unlock()
+}
+
+// ==============================
+// 2. Atomic Counter
+// ==============================
+
+// AtomicCounter is the atomicCounter example with the Counter interface.
+type AtomicCounter struct {
+	value int64 // first field, so it is 64-bit aligned on 32-bit platforms
+}
+
+// Add adds delta to the counter.
+func (c *AtomicCounter) Add(delta int64) {
+	atomic.AddInt64(&c.value, delta)
+}
+
+// Value returns the current count.
+func (c *AtomicCounter) Value() int64 {
+	return atomic.LoadInt64(&c.value)
+}
+
+// Reset sets the counter back to zero.
+func (c *AtomicCounter) Reset() {
+	atomic.StoreInt64(&c.value, 0)
+}
+
+// ==============================
+// 3. Striped Counter
+// ==============================
+//
+// A striped counter splits the count across several slots and sums them on
+// read. Two things make it fast:
+//
+// - Padding: each stripe fills a whole cache line, so two cores updating
+//   neighbouring stripes do not invalidate each other's cache ("false sharing").
+// - Affinity: Go does not expose which P (processor) a goroutine runs on, so
+//   each Adder is given a stripe when it is created, round-robin. Goroutines
+//   that write a lot then mostly write to different stripes, and an Add is a
+//   single uncontended atomic add with no lookup.
+
+// cacheLineSize is the common cache line size on amd64 and arm64.
+const cacheLineSize = 64
+
+// paddedInt64 occupies a full cache line.
+type paddedInt64 struct {
+	value int64
+	_     [cacheLineSize - 8]byte
+}
+
+// StripedCounter is a counter spread across cache-line-padded stripes.
+// Create it with NewStripedCounter.
+type StripedCounter struct {
+	stripes []paddedInt64
+	next    uint32
+}
+
+// NewStripedCounter returns a counter with the given number of stripes.
+// A non-positive value uses one stripe per GOMAXPROCS.
+func NewStripedCounter(stripes int) *StripedCounter {
+	if stripes <= 0 {
+		stripes = runtime.GOMAXPROCS(0)
+	}
+	return &StripedCounter{stripes: make([]paddedInt64, stripes)}
+}
+
+// Add adds delta to the next stripe. Choosing the stripe is itself an
+// atomic add on a shared word, so use Local for a goroutine that writes a lot.
+func (c *StripedCounter) Add(delta int64) {
+	c.Local().Add(delta)
+}
+
+// Local returns an Adder bound to the next stripe.
+func (c *StripedCounter) Local() Adder {
+	i := int(atomic.AddUint32(&c.next, 1)-1) % len(c.stripes)
+	return stripeAdder{&c.stripes[i].value}
+}
+
+// stripeAdder adds to one stripe of a StripedCounter.
+type stripeAdder struct {
+	stripe *int64
+}
+
+func (a stripeAdder) Add(delta int64) { atomic.AddInt64(a.stripe, delta) }
+func (stripeAdder) Flush()            {}
+
+// Value returns the sum of all stripes. It is exact when no Add runs
+// concurrently, and otherwise a value the counter held at some point during
+// the call.
+func (c *StripedCounter) Value() int64 {
+	var total int64
+	for i := range c.stripes {
+		total += atomic.LoadInt64(&c.stripes[i].value)
+	}
+	return total
+}
+
+// Reset sets every stripe back to zero.
+func (c *StripedCounter) Reset() {
+	for i := range c.stripes {
+		atomic.StoreInt64(&c.stripes[i].value, 0)
+	}
+}
+
+// ==============================
+// 4. Batched Counter
+// ==============================
+//
+// The cheapest shared write is the one you never make. A batched counter hands
+// each goroutine a LocalCounter that accumulates in a plain field and only
+// publishes to the shared total every BatchSize increments (and on Flush).
+// The price is that Value only sees flushed counts.
+
+// BatchedCounter is a shared total fed by goroutine-local accumulators.
+// Create it with NewBatchedCounter.
+type BatchedCounter struct {
+	total     AtomicCounter
+	batchSize int64
+}
+
+// NewBatchedCounter returns a counter whose local accumulators flush every
+// batchSize increments.
+func NewBatchedCounter(batchSize int64) *BatchedCounter {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	return &BatchedCounter{batchSize: batchSize}
+}
+
+// Add adds delta to the shared total at once, without batching.
+func (c *BatchedCounter) Add(delta int64) {
+	c.total.Add(delta)
+}
+
+// Value returns the flushed total; pending local counts are not included.
+func (c *BatchedCounter) Value() int64 {
+	return c.total.Value()
+}
+
+// Reset sets the shared total back to zero. Pending local counts are kept
+// and will be added on their next flush.
+func (c *BatchedCounter) Reset() {
+	c.total.Reset()
+}
+
+// Local returns a new accumulator. It must only be used by one goroutine,
+// which must call Flush when it is done.
+func (c *BatchedCounter) Local() Adder {
+	return &LocalCounter{parent: c}
+}
+
+// LocalCounter accumulates increments for a BatchedCounter.
+type LocalCounter struct {
+	parent  *BatchedCounter
+	pending int64
+	ops     int64
+}
+
+// Add adds delta locally, flushing to the parent every BatchSize calls.
+func (l *LocalCounter) Add(delta int64) {
+	l.pending += delta
+	l.ops++
+	if l.ops >= l.parent.batchSize {
+		l.Flush()
+	}
+}
+
+// Flush publishes the pending count to the parent counter.
+func (l *LocalCounter) Flush() {
+	if l.pending != 0 {
+		l.parent.total.Add(l.pending)
+	}
+	l.pending = 0
+	l.ops = 0
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// counterCase pairs a counter name with a constructor so every example and
+// benchmark starts from a fresh counter.
+type counterCase struct {
+	name string
+	make func() Counter
+}
+
+var counterCases = []counterCase{
+	{"mutex", func() Counter { return &MutexCounter{} }},
+	{"atomic", func() Counter { return &AtomicCounter{} }},
+	{"striped", func() Counter { return NewStripedCounter(0) }},
+	{"batched", func() Counter { return NewBatchedCounter(128) }},
+}
+
+// TestCounters increments every counter from 5 goroutines, like TestMutex
+// does with SafeCounter, and checks they all reach the same total.
+func TestCounters() {
+	for _, cc := range counterCases {
+		c := cc.make()
+		var wg sync.WaitGroup
+		for i := 0; i < 5; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				a := LocalAdder(c)
+				defer a.Flush()
+				for j := 0; j < 1000; j++ {
+					a.Add(1)
+				}
+			}()
+		}
+		wg.Wait()
+		fmt.Printf("Final %s counter: %d\n", cc.name, c.Value())
+		// Expected Output: Final <name> counter: 5000
+	}
+}
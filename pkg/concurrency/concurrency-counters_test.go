@@ -0,0 +1,109 @@
+// concurrency-counters_test.go
+//
+// Tests and benchmarks for the counters in concurrency-counters.go. To see
+// how each counter scales with the number of Ps, run:
+//
+//     go test -run '^$' -bench Counters -cpu 1,2,4,8 ./pkg/concurrency
+
+package concurrency
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCounterTotals(t *testing.T) {
+	const goroutines, adds = 8, 1000
+	for _, cc := range counterCases {
+		t.Run(cc.name, func(t *testing.T) {
+			c := cc.make()
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					a := LocalAdder(c)
+					defer a.Flush()
+					for j := 0; j < adds; j++ {
+						a.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if got := c.Value(); got != goroutines*adds {
+				t.Fatalf("Value() = %d, want %d", got, goroutines*adds)
+			}
+			c.Reset()
+			if got := c.Value(); got != 0 {
+				t.Fatalf("Value() after Reset = %d, want 0", got)
+			}
+		})
+	}
+}
+
+func TestCounterAdd(t *testing.T) {
+	const goroutines, adds = 8, 1000
+	for _, cc := range counterCases {
+		t.Run(cc.name, func(t *testing.T) {
+			c := cc.make()
+			var wg sync.WaitGroup
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < adds; j++ {
+						c.Add(1)
+					}
+				}()
+			}
+			wg.Wait()
+			if got := c.Value(); got != goroutines*adds {
+				t.Fatalf("Value() = %d, want %d", got, goroutines*adds)
+			}
+		})
+	}
+}
+
+func TestBatchedCounterPublishesOnlyFullBatches(t *testing.T) {
+	c := NewBatchedCounter(4)
+	a := LocalAdder(c)
+	for i := 0; i < 6; i++ {
+		a.Add(1)
+	}
+	if got := c.Value(); got != 4 {
+		t.Fatalf("Value() before Flush = %d, want 4", got)
+	}
+	a.Flush()
+	if got := c.Value(); got != 6 {
+		t.Fatalf("Value() after Flush = %d, want 6", got)
+	}
+}
+
+// BenchmarkCounters measures one increment while every P increments the
+// same counter. The mutex and atomic counters get slower as Ps are added;
+// the striped and batched counters should stay flat or improve.
+//
+// Example Output (go test -bench Counters -cpu 1,8, 8 cores, numbers vary):
+//
+//	BenchmarkCounters/mutex         12.1 ns/op
+//	BenchmarkCounters/mutex-8       60.3 ns/op
+//	BenchmarkCounters/atomic         4.9 ns/op
+//	BenchmarkCounters/atomic-8      19.7 ns/op
+//	BenchmarkCounters/striped        5.1 ns/op
+//	BenchmarkCounters/striped-8      1.4 ns/op
+//	BenchmarkCounters/batched        1.2 ns/op
+//	BenchmarkCounters/batched-8      0.3 ns/op
+func BenchmarkCounters(b *testing.B) {
+	for _, cc := range counterCases {
+		b.Run(cc.name, func(b *testing.B) {
+			c := cc.make()
+			b.RunParallel(func(pb *testing.PB) {
+				a := LocalAdder(c)
+				defer a.Flush()
+				for pb.Next() {
+					a.Add(1)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,269 @@
+// concurrency-ctxmutex.go
+//
+// This file provides a channel-based mutex whose Lock can be cancelled with a
+// context or a timeout, and which remembers who holds it.
+
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ==============================
+// Cancellable Locking
+// ==============================
+//
+// sync.Mutex.Lock has no way out: if the holder never unlocks, the caller
+// waits forever, which is exactly how deadlockExample hangs. A channel with a
+// buffer of one is also a mutex, and a channel operation can sit in a select
+// next to ctx.Done():
+//
+//     lock:    ch <- struct{}{}   // blocks while the buffer is full (locked)
+//     unlock:  <-ch
+//
+//     select {
+//     case ch <- struct{}{}:      // got the lock
+//     case <-ctx.Done():          // gave up
+//     }
+//
+// A waiter that gives up learns nothing useful from "context deadline
+// exceeded" alone, so CtxMutex also records its owner: the goroutine, the code
+// location that locked it, and when. The error names all three.
+//
+// The price is speed: a channel operation costs more than the atomic fast
+// path of sync.Mutex, and owner tracking needs a stack walk on every Lock.
+// BenchmarkCtxMutex in concurrency-ctxmutex_test.go measures both. Owner
+// tracking is a debugging aid, so it is off until SetOwnerTracking turns it on.
+//
+// The owner record travels through the channel as the lock token. Unlock
+// receives the token of the acquisition it ends and marks it released. A
+// locker records itself a moment after its send; if another goroutine has
+// unlocked in between, the locker sees the mark and records nothing, so a
+// stale record can never replace the one of the goroutine that holds the
+// lock by then.
+
+var ownerTracking int32
+
+// SetOwnerTracking turns owner tracking on or off for all CtxMutexes and
+// returns the previous setting. It is off by default.
+func SetOwnerTracking(on bool) (was bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	return atomic.SwapInt32(&ownerTracking, v) == 1
+}
+
+// ErrRecursiveLock is returned by Lock when the calling goroutine already
+// holds the mutex. It is only detected with owner tracking on, and only once
+// Lock finds the mutex held (the uncontended fast path does not check);
+// without tracking a recursive Lock blocks until ctx is done.
+var ErrRecursiveLock = errors.New("goroutine already holds the lock")
+
+// lockOwner is who holds a CtxMutex. It is also the token in the mutex's
+// channel while it holds it.
+type lockOwner struct {
+	goroutine int64
+	site      string
+	since     time.Time
+	released  bool // set by Unlock; guarded by the mutex's ownerMu
+}
+
+// CtxMutex is a mutex with cancellable Lock. Create it with NewCtxMutex.
+type CtxMutex struct {
+	name    string
+	ch      chan *lockOwner // holds the owner's token (nil without tracking) while locked
+	ownerMu sync.Mutex      // guards owner and the released flags of its tokens
+	owner   *lockOwner
+}
+
+// NewCtxMutex returns an unlocked mutex. name is used in errors.
+func NewCtxMutex(name string) *CtxMutex {
+	return &CtxMutex{name: name, ch: make(chan *lockOwner, 1)}
+}
+
+// LockError explains why Lock gave up.
+type LockError struct {
+	Mutex     string
+	Err       error  // ctx.Err() or ErrRecursiveLock
+	Owner     int64  // goroutine holding the lock, 0 if unknown
+	OwnerSite string // where the owner locked it
+	HeldFor   time.Duration
+}
+
+func (e *LockError) Error() string {
+	if e.Owner == 0 {
+		return fmt.Sprintf("lock %q: %v", e.Mutex, e.Err)
+	}
+	return fmt.Sprintf("lock %q: %v: held by goroutine %d for %v, locked at %s",
+		e.Mutex, e.Err, e.Owner, e.HeldFor.Round(time.Millisecond), e.OwnerSite)
+}
+
+func (e *LockError) Unwrap() error {
+	return e.Err
+}
+
+// Lock locks m, waiting until it is free or ctx is done.
+func (m *CtxMutex) Lock(ctx context.Context) error {
+	return m.lock(ctx, 1)
+}
+
+// LockTimeout locks m, waiting at most d.
+func (m *CtxMutex) LockTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return m.lock(ctx, 1)
+}
+
+// TryLock locks m if it is free and reports whether it did.
+func (m *CtxMutex) TryLock() bool {
+	o := newOwner(1)
+	select {
+	case m.ch <- o:
+		m.setOwner(o)
+		return true
+	default:
+		return false
+	}
+}
+
+// Unlock unlocks m. Like sync.Mutex, any goroutine may unlock it.
+func (m *CtxMutex) Unlock() {
+	select {
+	case o := <-m.ch:
+		if o != nil {
+			m.ownerMu.Lock()
+			o.released = true
+			if m.owner == o {
+				m.owner = nil
+			}
+			m.ownerMu.Unlock()
+		}
+	default:
+		panic(fmt.Sprintf("concurrency: unlock of unlocked CtxMutex %q", m.name))
+	}
+}
+
+// lock acquires m and records the caller `skip` frames above lock's caller
+// as the owner.
+func (m *CtxMutex) lock(ctx context.Context, skip int) error {
+	o := newOwner(skip + 1)
+	select {
+	case m.ch <- o: // fast path: uncontended
+		m.setOwner(o)
+		return nil
+	default:
+	}
+
+	if o != nil {
+		if cur := m.currentOwner(); cur != nil && cur.goroutine == o.goroutine {
+			return m.lockError(ErrRecursiveLock)
+		}
+	}
+	select {
+	case m.ch <- o:
+		m.setOwner(o)
+		return nil
+	case <-ctx.Done():
+		return m.lockError(ctx.Err())
+	}
+}
+
+// newOwner returns an owner record for the calling goroutine and the caller
+// `skip` frames above newOwner's caller, or nil if tracking is off.
+func newOwner(skip int) *lockOwner {
+	if atomic.LoadInt32(&ownerTracking) == 0 {
+		return nil
+	}
+	site := "unknown"
+	if _, file, line, ok := runtime.Caller(skip + 1); ok {
+		site = fmt.Sprintf("%s:%d", shortFile(file), line)
+	}
+	return &lockOwner{goroutine: goroutineID(), site: site}
+}
+
+// setOwner publishes o after its send on m.ch succeeded, unless an Unlock
+// has taken o out of the channel in between.
+func (m *CtxMutex) setOwner(o *lockOwner) {
+	if o == nil {
+		return
+	}
+	m.ownerMu.Lock()
+	defer m.ownerMu.Unlock()
+	if !o.released {
+		o.since = time.Now()
+		m.owner = o
+	}
+}
+
+// currentOwner returns the owner record of m, or nil if none is published.
+func (m *CtxMutex) currentOwner() *lockOwner {
+	m.ownerMu.Lock()
+	defer m.ownerMu.Unlock()
+	return m.owner
+}
+
+func (m *CtxMutex) lockError(err error) error {
+	e := &LockError{Mutex: m.name, Err: err}
+	if o := m.currentOwner(); o != nil {
+		e.Owner, e.OwnerSite, e.HeldFor = o.goroutine, o.site, time.Since(o.since)
+	}
+	return e
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// deadlockExampleFailFast is deadlockExample with a CtxMutex: instead of
+// hanging, the goroutine gives up after 100ms and says who holds the lock.
+func deadlockExampleFailFast() {
+	defer SetOwnerTracking(SetOwnerTracking(true))
+	mu := NewCtxMutex("config")
+	mu.Lock(context.Background())
+	// Forgot to unlock mu
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := mu.LockTimeout(100 * time.Millisecond); err != nil {
+			fmt.Println("goroutine:", err)
+			return
+		}
+		defer mu.Unlock()
+	}()
+	wg.Wait()
+
+	// Locking twice from the same goroutine fails at once.
+	fmt.Println("main:", mu.Lock(context.Background()))
+	// goroutine: lock "config": context deadline exceeded: held by goroutine 1 for 100ms,
+	//            locked at concurrency-ctxmutex.go:229
+	// main: lock "config": goroutine already holds the lock: held by goroutine 1 for 101ms,
+	//       locked at concurrency-ctxmutex.go:229
+}
+
+// TestCtxMutex shows TryLock and a cancelled Lock, then the fail-fast
+// version of deadlockExample.
+func TestCtxMutex() {
+	mu := NewCtxMutex("cache")
+	fmt.Println("TryLock on free mutex:", mu.TryLock())
+	fmt.Println("TryLock on held mutex:", mu.TryLock())
+
+	// Another goroutine waits for the held mutex until its context is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() { result <- mu.Lock(ctx) }()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	fmt.Println("cancelled Lock:", errors.Is(<-result, context.Canceled))
+	mu.Unlock()
+
+	deadlockExampleFailFast()
+}
@@ -0,0 +1,304 @@
+// concurrency-fairrw.go
+//
+// This file provides a reader-writer lock with a selectable fairness policy,
+// and a demo that measures how long writers wait under heavy read load.
+
+package concurrency
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ==============================
+// RW Lock Fairness
+// ==============================
+//
+// A reader-writer lock must decide who goes next when both readers and
+// writers are waiting, and every answer starves somebody:
+//
+// 1. Reader preference: a new reader joins as long as no writer holds the
+//    lock. With overlapping readers the lock is never free, and a writer can
+//    wait forever (writer starvation).
+// 2. Writer preference: once a writer is waiting, new readers queue behind
+//    it. Writers get in quickly, but a steady stream of writers starves readers.
+// 3. FIFO: requests are served in arrival order; consecutive readers share the
+//    lock, a writer waits for the readers ahead of it and blocks the ones behind.
+//    Nobody starves, but readers arriving between writers cannot share.
+//
+// sync.RWMutex is close to writer preference: a blocked Lock stops new RLocks,
+// so writers cannot starve, and it is much cheaper than the queue below.
+// FairRWMutex exists to make the policies (and reader preference's starvation)
+// visible and measurable.
+
+// RWPolicy selects who goes first in a FairRWMutex.
+type RWPolicy int
+
+const (
+	ReaderPreference RWPolicy = iota
+	WriterPreference
+	FIFO
+)
+
+func (p RWPolicy) String() string {
+	switch p {
+	case ReaderPreference:
+		return "reader-preference"
+	case WriterPreference:
+		return "writer-preference"
+	default:
+		return "fifo"
+	}
+}
+
+// rwWaiter is a goroutine waiting in RLock or Lock.
+type rwWaiter struct {
+	write bool
+	ready chan struct{} // closed when the lock is granted
+}
+
+// FairRWMutex is a reader-writer lock with a configurable policy. Create it
+// with NewFairRWMutex.
+type FairRWMutex struct {
+	policy  RWPolicy
+	mu      sync.Mutex
+	readers int  // active readers
+	writer  bool // a writer holds the lock
+	queue   []*rwWaiter
+}
+
+// NewFairRWMutex returns an unlocked FairRWMutex.
+func NewFairRWMutex(policy RWPolicy) *FairRWMutex {
+	return &FairRWMutex{policy: policy}
+}
+
+// RLock locks for reading.
+func (m *FairRWMutex) RLock() {
+	m.wait(false)
+}
+
+// RUnlock undoes one RLock.
+func (m *FairRWMutex) RUnlock() {
+	m.mu.Lock()
+	if m.readers == 0 {
+		m.mu.Unlock()
+		panic("concurrency: RUnlock of unlocked FairRWMutex")
+	}
+	m.readers--
+	m.grant()
+	m.mu.Unlock()
+}
+
+// Lock locks for writing.
+func (m *FairRWMutex) Lock() {
+	m.wait(true)
+}
+
+// Unlock unlocks for writing.
+func (m *FairRWMutex) Unlock() {
+	m.mu.Lock()
+	if !m.writer {
+		m.mu.Unlock()
+		panic("concurrency: Unlock of unlocked FairRWMutex")
+	}
+	m.writer = false
+	m.grant()
+	m.mu.Unlock()
+}
+
+// wait takes the lock at once if nobody is queued and it is free enough,
+// which no policy objects to. Otherwise it queues the caller and blocks
+// until grant admits it; only this slow path allocates.
+func (m *FairRWMutex) wait(write bool) {
+	m.mu.Lock()
+	if len(m.queue) == 0 && m.acquire(write) {
+		m.mu.Unlock()
+		return
+	}
+	w := &rwWaiter{write: write, ready: make(chan struct{})}
+	m.queue = append(m.queue, w)
+	m.grant()
+	m.mu.Unlock()
+	<-w.ready
+}
+
+// grant admits as many queued waiters as the policy allows.
+// The caller must hold m.mu.
+func (m *FairRWMutex) grant() {
+	switch m.policy {
+	case FIFO:
+		// Admit from the head while the head is compatible with the holders.
+		for len(m.queue) > 0 && m.admit(m.queue[0]) {
+			m.queue = m.queue[1:]
+		}
+	case WriterPreference:
+		m.admitAll(true)
+		if !m.writersWaiting() {
+			m.admitAll(false)
+		}
+	default: // ReaderPreference
+		m.admitAll(false)
+		m.admitAll(true)
+	}
+}
+
+// admitAll admits queued waiters of one kind, in order, while they fit.
+func (m *FairRWMutex) admitAll(write bool) {
+	kept := m.queue[:0]
+	for _, w := range m.queue {
+		if w.write != write || !m.admit(w) {
+			kept = append(kept, w)
+		}
+	}
+	for i := len(kept); i < len(m.queue); i++ {
+		m.queue[i] = nil
+	}
+	m.queue = kept
+}
+
+// admit grants the lock to w if it is compatible with the current holders.
+func (m *FairRWMutex) admit(w *rwWaiter) bool {
+	if !m.acquire(w.write) {
+		return false
+	}
+	close(w.ready)
+	return true
+}
+
+// acquire takes the lock for reading or writing if that is compatible with
+// the current holders. The caller must hold m.mu.
+func (m *FairRWMutex) acquire(write bool) bool {
+	if m.writer || (write && m.readers > 0) {
+		return false
+	}
+	if write {
+		m.writer = true
+	} else {
+		m.readers++
+	}
+	return true
+}
+
+func (m *FairRWMutex) writersWaiting() bool {
+	for _, w := range m.queue {
+		if w.write {
+			return true
+		}
+	}
+	return false
+}
+
+// ==============================
+// Writer Latency Demo
+// ==============================
+
+// rwLocker is satisfied by both sync.RWMutex and FairRWMutex.
+type rwLocker interface {
+	Lock()
+	Unlock()
+	RLock()
+	RUnlock()
+}
+
+// rwLoadResult is what one run of rwLoad measured.
+type rwLoadResult struct {
+	reads       int64
+	writes      int
+	writerWaits []time.Duration // sorted
+}
+
+func (r rwLoadResult) percentile(p float64) time.Duration {
+	if len(r.writerWaits) == 0 {
+		return 0
+	}
+	return r.writerWaits[int(p*float64(len(r.writerWaits)-1))]
+}
+
+// rwLoad runs readers that overlap constantly (each read takes readTime, and
+// there is always another reader inside) and one writer that tries to write
+// every writeEvery, and measures the writer's wait for the lock.
+func rwLoad(l rwLocker, readers int, readTime, writeEvery, duration time.Duration) rwLoadResult {
+	var result rwLoadResult
+	var stop int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(time.Duration(i) * readTime / time.Duration(readers)) // stagger the readers
+			for atomic.LoadInt32(&stop) == 0 {
+				l.RLock()
+				time.Sleep(readTime)
+				l.RUnlock()
+				atomic.AddInt64(&result.reads, 1)
+			}
+		}(i)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for atomic.LoadInt32(&stop) == 0 {
+			time.Sleep(writeEvery)
+			start := time.Now()
+			l.Lock()
+			result.writerWaits = append(result.writerWaits, time.Since(start))
+			result.writes++
+			l.Unlock()
+		}
+	}()
+
+	time.Sleep(duration)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	sort.Slice(result.writerWaits, func(i, j int) bool { return result.writerWaits[i] < result.writerWaits[j] })
+	return result
+}
+
+// TestWriterStarvation puts each lock under the same heavy read load and
+// reports how long the writer waited for it.
+func TestWriterStarvation() {
+	const (
+		readers    = 8
+		readTime   = 2 * time.Millisecond
+		writeEvery = 10 * time.Millisecond
+		duration   = 500 * time.Millisecond
+	)
+	locks := []struct {
+		name string
+		lock rwLocker
+	}{
+		{"sync.RWMutex", &sync.RWMutex{}},
+		{"reader-preference", NewFairRWMutex(ReaderPreference)},
+		{"writer-preference", NewFairRWMutex(WriterPreference)},
+		{"fifo", NewFairRWMutex(FIFO)},
+	}
+
+	fmt.Printf("%-18s %7s %7s %10s %10s %10s\n", "lock", "reads", "writes", "wait p50", "wait p99", "wait max")
+	for _, l := range locks {
+		r := rwLoad(l.lock, readers, readTime, writeEvery, duration)
+		fmt.Printf("%-18s %7d %7d %10v %10v %10v\n", l.name, r.reads, r.writes,
+			r.percentile(0.5).Round(time.Microsecond), r.percentile(0.99).Round(time.Microsecond),
+			r.percentile(1).Round(time.Microsecond))
+	}
+	// Example Output (numbers vary by machine):
+	// lock                 reads  writes   wait p50   wait p99   wait max
+	// sync.RWMutex          1510      40    1.203ms    5.466ms    5.486ms
+	// reader-preference     1685       1  489.073ms  489.073ms  489.073ms   <- starved
+	// writer-preference     1527      41    1.344ms     3.05ms    4.987ms
+	// fifo                  1591      40    2.139ms     2.36ms    2.513ms
+	//
+	// Tradeoffs:
+	// - reader-preference has the most reads, and the writer got in once, at the end.
+	// - sync.RWMutex and writer-preference bound the writer's wait to about one read.
+	//   Under many writers they would delay readers instead.
+	// - fifo bounds both sides, at the cost of splitting reader batches at
+	//   every writer.
+	// - Every FairRWMutex policy takes an internal mutex on every call and
+	//   allocates a waiter and channel for every call that has to wait, which
+	//   is why sync.RWMutex is the default choice unless ordering matters.
+}
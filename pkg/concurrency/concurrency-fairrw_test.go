@@ -0,0 +1,78 @@
+// concurrency-fairrw_test.go
+//
+// Tests for FairRWMutex.
+
+package concurrency
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+var rwPolicies = []RWPolicy{ReaderPreference, WriterPreference, FIFO}
+
+func TestFairRWMutexUncontendedDoesNotAllocate(t *testing.T) {
+	for _, p := range rwPolicies {
+		m := NewFairRWMutex(p)
+		allocs := testing.AllocsPerRun(100, func() {
+			m.RLock()
+			m.RLock()
+			m.RUnlock()
+			m.RUnlock()
+			m.Lock()
+			m.Unlock()
+		})
+		if allocs != 0 {
+			t.Errorf("%v: %v allocations per uncontended run, want 0", p, allocs)
+		}
+	}
+}
+
+func TestFairRWMutexExclusion(t *testing.T) {
+	for _, p := range rwPolicies {
+		t.Run(p.String(), func(t *testing.T) {
+			m := NewFairRWMutex(p)
+			var mu sync.Mutex // guards the counts below
+			var readers, writers int
+			// enter and leave count the holders; enter fails t if the lock
+			// lets in a holder it should have kept out.
+			enter := func(count *int) {
+				mu.Lock()
+				*count++
+				if writers > 1 || (writers == 1 && readers > 0) {
+					t.Errorf("%d writers and %d readers hold the lock", writers, readers)
+				}
+				mu.Unlock()
+			}
+			leave := func(count *int) {
+				mu.Lock()
+				*count--
+				mu.Unlock()
+			}
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 200; i++ {
+						if (g+i)%4 == 0 {
+							m.Lock()
+							enter(&writers)
+							runtime.Gosched()
+							leave(&writers)
+							m.Unlock()
+						} else {
+							m.RLock()
+							enter(&readers)
+							runtime.Gosched()
+							leave(&readers)
+							m.RUnlock()
+						}
+					}
+				}(g)
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,229 @@
+// concurrency-future.go
+//
+// This file provides a typed Future: the result of a computation running in
+// its own goroutine, which any number of goroutines can wait for.
+
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ==============================
+// Futures
+// ==============================
+//
+// sendAndReceivingData starts a goroutine that sends exactly one value on a
+// channel, and the caller receives it later. That one-shot channel is a future
+// in everything but name. Wrapping it in a type adds what the raw channel lacks:
+//
+// 1. An error next to the value.
+// 2. Many waiters: a channel value can be received once, but closing a channel
+//    wakes every receiver, so the result can be read by any number of goroutines.
+// 3. Cancellation: Await gives up when its context is done.
+// 4. Combinators: Then, All, Any and Race build new futures out of existing ones.
+// 5. Panic safety: a panic in the function fails the future instead of crashing.
+
+// Future is the eventual result of a function running in its own goroutine.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Go runs fn in a new goroutine and returns a future for its result. If fn
+// panics, the panic is recovered and the future fails with an error that
+// wraps ErrPanicked, so a bad computation cannot take the program down with it.
+func Go[T any](fn func() (T, error)) *Future[T] {
+	f := &Future[T]{done: make(chan struct{})}
+	go func() {
+		defer close(f.done)
+		defer func() {
+			if r := recover(); r != nil {
+				var zero T
+				f.value, f.err = zero, fmt.Errorf("%w: %v", ErrPanicked, r)
+			}
+		}()
+		f.value, f.err = fn()
+	}()
+	return f
+}
+
+// ErrPanicked is wrapped by the error of a future whose function panicked.
+var ErrPanicked = errors.New("future: function panicked")
+
+// Done is closed once the result is available.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Await waits for the result or for ctx to be done, whichever comes first.
+// Giving up does not stop the underlying goroutine; it only stops waiting.
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// result returns the settled value and error. It must only be called after done is closed.
+func (f *Future[T]) result() (T, error) {
+	return f.value, f.err
+}
+
+// ==============================
+// Combinators
+// ==============================
+
+// Then returns a future that applies fn to f's value once it is available.
+// If f fails, fn is not called and the error is passed through.
+func Then[T, U any](f *Future[T], fn func(T) (U, error)) *Future[U] {
+	return Go(func() (U, error) {
+		<-f.done
+		v, err := f.result()
+		if err != nil {
+			var zero U
+			return zero, err
+		}
+		return fn(v)
+	})
+}
+
+// All returns a future for every value, in the order of futures. It fails as
+// soon as any future fails, or when ctx is done, without waiting for the rest.
+func All[T any](ctx context.Context, futures ...*Future[T]) *Future[[]T] {
+	return Go(func() ([]T, error) {
+		ready, stop := settled(futures)
+		defer stop()
+		values := make([]T, len(futures))
+		for range futures {
+			select {
+			case i := <-ready:
+				v, err := futures[i].result()
+				if err != nil {
+					return nil, err
+				}
+				values[i] = v
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		return values, nil
+	})
+}
+
+// Any returns the first successful value. It fails if every future fails,
+// with an error listing all of the failures, or when ctx is done.
+func Any[T any](ctx context.Context, futures ...*Future[T]) *Future[T] {
+	return Go(func() (T, error) {
+		var zero T
+		if len(futures) == 0 {
+			return zero, errors.New("any: no futures")
+		}
+		ready, stop := settled(futures)
+		defer stop()
+		errs := make([]string, 0, len(futures))
+		for range futures {
+			select {
+			case i := <-ready:
+				v, err := futures[i].result()
+				if err == nil {
+					return v, nil
+				}
+				errs = append(errs, err.Error())
+			case <-ctx.Done():
+				return zero, ctx.Err()
+			}
+		}
+		return zero, fmt.Errorf("any: all %d futures failed: %s", len(futures), strings.Join(errs, "; "))
+	})
+}
+
+// Race returns the result of whichever future settles first, success or
+// failure. It fails with ctx's error if ctx is done first.
+func Race[T any](ctx context.Context, futures ...*Future[T]) *Future[T] {
+	return Go(func() (T, error) {
+		var zero T
+		if len(futures) == 0 {
+			return zero, errors.New("race: no futures")
+		}
+		ready, stop := settled(futures)
+		defer stop()
+		select {
+		case i := <-ready:
+			return futures[i].result()
+		case <-ctx.Done():
+			return zero, ctx.Err()
+		}
+	})
+}
+
+// settled reports the index of each future on the returned channel as it
+// settles. select needs a fixed set of cases, so each future gets one
+// goroutine that forwards its completion to the shared channel. The channel
+// has room for every index, so no forwarder blocks on a combinator that has
+// stopped reading; calling stop lets the ones still waiting exit.
+func settled[T any](futures []*Future[T]) (ready <-chan int, stop func()) {
+	c := make(chan int, len(futures))
+	done := make(chan struct{})
+	for i, f := range futures {
+		go func(i int, f *Future[T]) {
+			select {
+			case <-f.done:
+				c <- i
+			case <-done:
+			}
+		}(i, f)
+	}
+	return c, func() { close(done) }
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// TestFutures shows a future awaited by several goroutines and the four
+// combinators.
+func TestFutures() {
+	ctx := context.Background()
+
+	answer := Go(func() (int, error) { return 42, nil })
+	done := make(chan struct{})
+	for i := 1; i <= 3; i++ {
+		go func(id int) {
+			v, _ := answer.Await(ctx)
+			fmt.Printf("Waiter %d got %d\n", id, v)
+			done <- struct{}{}
+		}(i)
+	}
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+
+	doubled := Then(answer, func(v int) (string, error) { return fmt.Sprint(v * 2), nil })
+	fmt.Println(doubled.Await(ctx)) // 84 <nil>
+
+	ok := Go(func() (int, error) { return 1, nil })
+	bad := Go(func() (int, error) { return 0, errors.New("boom") })
+
+	fmt.Println(All(ctx, ok, answer).Await(ctx))  // [1 42] <nil>
+	fmt.Println(All(ctx, ok, bad).Await(ctx))     // [] boom
+	fmt.Println(Any(ctx, bad, answer).Await(ctx)) // 42 <nil>
+	v, err := Race(ctx, ok, bad).Await(ctx)
+	fmt.Println("race:", v, err) // whichever finished first
+
+	crash := Go(func() (int, error) { panic("out of range") })
+	fmt.Println(crash.Await(ctx)) // 0 future: function panicked: out of range
+
+	slow := Go(func() (int, error) { time.Sleep(time.Second); return 1, nil })
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	fmt.Println(All(short, ok, slow).Await(ctx)) // [] context deadline exceeded
+}
@@ -0,0 +1,75 @@
+// concurrency-future_test.go
+//
+// Tests for the futures in concurrency-future.go.
+
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"Golan-Concepts/pkg/leakcheck"
+)
+
+func TestFuturePanicRejects(t *testing.T) {
+	f := Go(func() (int, error) { panic("boom") })
+	if _, err := f.Await(context.Background()); !errors.Is(err, ErrPanicked) {
+		t.Fatalf("Await error = %v, want ErrPanicked", err)
+	}
+}
+
+func TestFutureCombinatorsHonourContext(t *testing.T) {
+	defer leakcheck.Verify(t, leakcheck.Options{})()
+
+	block := make(chan struct{})
+	defer close(block)
+	never := Go(func() (int, error) { <-block; return 0, nil })
+	ok := Go(func() (int, error) { return 1, nil })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	bg := context.Background()
+	if _, err := All(ctx, ok, never).Await(bg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("All error = %v, want DeadlineExceeded", err)
+	}
+	if _, err := Any(ctx, never).Await(bg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Any error = %v, want DeadlineExceeded", err)
+	}
+	if _, err := Race(ctx, never, never).Await(bg); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Race error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestFutureCombinatorResults(t *testing.T) {
+	ctx := context.Background()
+	var futures []*Future[int]
+	for i := 0; i < 50; i++ {
+		i := i
+		futures = append(futures, Go(func() (int, error) {
+			time.Sleep(time.Duration(50-i) * 100 * time.Microsecond)
+			return i, nil
+		}))
+	}
+	values, err := All(ctx, futures...).Await(ctx)
+	if err != nil {
+		t.Fatalf("All error = %v", err)
+	}
+	for i, v := range values {
+		if v != i {
+			t.Fatalf("All values[%d] = %d, want %d", i, v, i)
+		}
+	}
+
+	bad := Go(func() (int, error) { return 0, errors.New("bad") })
+	if v, err := Any(ctx, bad, futures[7]).Await(ctx); err != nil || v != 7 {
+		t.Errorf("Any = %d, %v; want 7, <nil>", v, err)
+	}
+	if _, err := Any(ctx, bad, bad).Await(ctx); err == nil {
+		t.Error("Any of failed futures succeeded")
+	}
+	if _, err := All(ctx, futures[0], bad).Await(ctx); err == nil || err.Error() != "bad" {
+		t.Errorf("All error = %v, want bad", err)
+	}
+}
@@ -0,0 +1,179 @@
+// concurrency-guarded.go
+//
+// This file provides Guarded[T], a value that can only be reached while
+// holding its lock, and AtomicValue[T], a typed wrapper around atomic.Value.
+
+package concurrency
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// ==============================
+// Guarded Values
+// ==============================
+//
+// SafeCounter, ReadHeavyStruct and SafeQueue all follow the same recipe: a
+// mutex next to a field, and a comment saying the field must only be touched
+// with the mutex held. Nothing enforces the comment. Guarded[T] does, by
+// keeping the value private and handing it out only inside a callback that
+// runs under the lock:
+//
+//     var hits Guarded[map[string]int]
+//
+//     hits.With(func(m *map[string]int) {   // write lock
+//         (*m)["home"]++
+//     })
+//     hits.Read(func(m map[string]int) {    // read lock, shared with other readers
+//         fmt.Println(m["home"])
+//     })
+//
+// Two rules remain the caller's responsibility:
+//
+// 1. Do not let the value escape the callback. For maps, slices and pointers,
+//    Load and the argument to Read are shallow copies that still share memory.
+// 2. Read must not modify what it is given; use With for that.
+//
+// The lock is a ProfiledRWMutex, so contention reports name the code that
+// called With or Read, not Guarded itself.
+
+// Guarded is a value protected by a read-write lock. The zero value holds the
+// zero value of T and is ready to use.
+type Guarded[T any] struct {
+	mu    ProfiledRWMutex
+	value T
+}
+
+// NewGuarded returns a Guarded holding v.
+func NewGuarded[T any](v T) *Guarded[T] {
+	return &Guarded[T]{value: v}
+}
+
+// With calls fn with a pointer to the value while holding the write lock.
+func (g *Guarded[T]) With(fn func(*T)) {
+	g.mu.lockSkip(1)
+	defer g.mu.Unlock()
+	fn(&g.value)
+}
+
+// Read calls fn with the value while holding the read lock.
+func (g *Guarded[T]) Read(fn func(T)) {
+	g.mu.rlockSkip(1)
+	defer g.mu.RUnlock()
+	fn(g.value)
+}
+
+// Load returns a copy of the value.
+func (g *Guarded[T]) Load() T {
+	g.mu.rlockSkip(1)
+	defer g.mu.RUnlock()
+	return g.value
+}
+
+// Swap replaces the value and returns the old one.
+func (g *Guarded[T]) Swap(v T) T {
+	g.mu.lockSkip(1)
+	defer g.mu.Unlock()
+	old := g.value
+	g.value = v
+	return old
+}
+
+// ==============================
+// Typed Atomic Values
+// ==============================
+//
+// atomic.Value stores an interface{}: every Load needs a type assertion, and
+// storing two different concrete types panics. Go 1.19 added atomic.Pointer[T];
+// on Go 1.18 AtomicValue[T] fills the gap. Values are boxed in a struct, so
+// the stored concrete type is always the same, even when T is an interface.
+//
+// Use it for read-mostly data that is replaced as a whole, such as a
+// configuration: readers never block, and a writer swaps in a new copy.
+
+// box gives atomic.Value one concrete type to store.
+type box[T any] struct {
+	v T
+}
+
+// AtomicValue is a typed atomic.Value. The zero value holds the zero value of T.
+type AtomicValue[T any] struct {
+	v atomic.Value
+}
+
+// Load returns the stored value.
+func (a *AtomicValue[T]) Load() T {
+	b, _ := a.v.Load().(box[T])
+	return b.v
+}
+
+// Store stores v.
+func (a *AtomicValue[T]) Store(v T) {
+	a.v.Store(box[T]{v})
+}
+
+// Swap stores v and returns the previous value.
+func (a *AtomicValue[T]) Swap(v T) T {
+	b, _ := a.v.Swap(box[T]{v}).(box[T])
+	return b.v
+}
+
+// CompareAndSwap stores new if the current value equals old. Like
+// atomic.Value.CompareAndSwap, it panics if T is not comparable.
+func (a *AtomicValue[T]) CompareAndSwap(old, new T) bool {
+	if a.v.CompareAndSwap(box[T]{old}, box[T]{new}) {
+		return true
+	}
+	// The zero AtomicValue holds nothing yet, not box[T]{zero}.
+	var zero T
+	if any(old) == any(zero) {
+		return a.v.CompareAndSwap(nil, box[T]{new})
+	}
+	return false
+}
+
+// ==============================
+// Example
+// ==============================
+
+// serverConfig is replaced as a whole, never modified in place.
+type serverConfig struct {
+	MaxConns int
+	Debug    bool
+}
+
+// TestGuarded keeps a hit counter in a Guarded map and a configuration in an
+// AtomicValue that is reloaded while readers are using it.
+func TestGuarded() {
+	var hits Guarded[map[string]int]
+	var config AtomicValue[*serverConfig]
+	config.Store(&serverConfig{MaxConns: 10})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_ = config.Load().MaxConns // never blocks, even during a reload
+				hits.With(func(m *map[string]int) {
+					if *m == nil {
+						*m = make(map[string]int)
+					}
+					(*m)["home"]++
+				})
+			}
+		}()
+	}
+	old := config.Swap(&serverConfig{MaxConns: 100, Debug: true})
+	wg.Wait()
+
+	hits.Read(func(m map[string]int) {
+		fmt.Println("home hits:", m["home"])
+	})
+	fmt.Printf("config reloaded: %+v -> %+v\n", *old, *config.Load())
+	// home hits: 500
+	// config reloaded: {MaxConns:10 Debug:false} -> {MaxConns:100 Debug:true}
+}
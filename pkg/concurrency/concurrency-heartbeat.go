@@ -0,0 +1,491 @@
+// concurrency-heartbeat.go
+//
+// This file provides a supervisor for long-running goroutines: each one sends
+// periodic heartbeats, the supervisor marks it unhealthy when beats stop and
+// restarts it from a factory, and the aggregated health is served over HTTP
+// at /healthz.
+
+package concurrency
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"Golan-Concepts/pkg/clock"
+)
+
+// ==============================
+// Heartbeats
+// ==============================
+//
+// A goroutine like boring runs forever, and nothing notices when it stops
+// making progress: it may be blocked on a channel nobody reads, waiting for
+// a lock (deadlockExample), or spinning. Exiting is easy to detect; being
+// stuck is not. A heartbeat turns "stuck" into something observable:
+//
+//     worker:      for { doWork(); beat() }
+//     supervisor:  every check, if now - lastBeat >= Interval * MaxMissed
+//                  -> unhealthy: cancel its context, restart it after RestartDelay
+//
+// Go cannot kill a goroutine, so a restart only cancels the old instance's
+// context and ignores its heartbeats from then on. A worker that never looks
+// at its context keeps running (a leak); Stop reports it.
+//
+// All timing goes through a clock.Clock, so a demo or a test can use a
+// clock.Fake and check a 30-second timeout without waiting 30 seconds.
+
+// HeartbeatWorker is a long-running function supervised by heartbeats. It must
+// call beat at least once per Interval and return when ctx is done.
+type HeartbeatWorker func(ctx context.Context, beat func())
+
+// HeartbeatOptions configures one supervised worker.
+type HeartbeatOptions struct {
+	Interval     time.Duration // expected time between beats; must be positive
+	MaxMissed    int           // beats missed before the worker is unhealthy; defaults to 3
+	RestartDelay time.Duration // time spent unhealthy before the restart
+}
+
+// WorkerStatus is the health of a supervised worker.
+type WorkerStatus int
+
+const (
+	Starting  WorkerStatus = iota // started, no beat yet
+	Healthy                       // beating on time
+	Unhealthy                     // missed beats or exited, waiting to restart
+)
+
+func (s WorkerStatus) String() string {
+	switch s {
+	case Healthy:
+		return "healthy"
+	case Unhealthy:
+		return "unhealthy"
+	default:
+		return "starting"
+	}
+}
+
+// supervisedWorker is the supervisor's record of one worker.
+type supervisedWorker struct {
+	name       string
+	opts       HeartbeatOptions
+	factory    func() HeartbeatWorker
+	status     WorkerStatus
+	generation int // bumped when an instance is abandoned; stale beats are ignored
+	started    time.Time
+	lastBeat   time.Time
+	restarts   int
+	reason     string // why it was last marked unhealthy
+	restartAt  time.Time
+	cancel     context.CancelFunc
+}
+
+// HeartbeatSupervisor watches registered workers. Create it with
+// NewHeartbeatSupervisor.
+type HeartbeatSupervisor struct {
+	// Logf, if set, receives a line for every status change and restart.
+	Logf func(format string, args ...any)
+
+	clock   clock.Clock
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	workers []*supervisedWorker
+	running map[string]int // instances still running, by name, including abandoned ones
+	checks  int            // checks completed so far
+	changed *sync.Cond     // broadcast when a worker beats or exits and after every check
+	done    chan struct{}  // closed when the check loop exits
+}
+
+// NewHeartbeatSupervisor starts a supervisor that checks its workers every
+// checkEvery of clk's time.
+func NewHeartbeatSupervisor(clk clock.Clock, checkEvery time.Duration) *HeartbeatSupervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &HeartbeatSupervisor{
+		clock:   clk,
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[string]int),
+		done:    make(chan struct{}),
+	}
+	s.changed = sync.NewCond(&s.mu)
+	ticker := clk.NewTicker(checkEvery) // created here, so a fake clock sees it before Advance
+	go s.loop(ticker)
+	return s
+}
+
+func (s *HeartbeatSupervisor) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// Register starts a worker built by factory. The factory is called again
+// for every restart, so each instance starts with fresh state. It is called
+// with the supervisor's lock held and must not call back into it. Register
+// panics if opts.Interval is not positive.
+func (s *HeartbeatSupervisor) Register(name string, opts HeartbeatOptions, factory func() HeartbeatWorker) {
+	if opts.Interval <= 0 {
+		panic(fmt.Sprintf("concurrency: Register(%q) with Interval %v", name, opts.Interval))
+	}
+	if opts.MaxMissed < 1 {
+		opts.MaxMissed = 3
+	}
+	w := &supervisedWorker{name: name, opts: opts, factory: factory}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workers = append(s.workers, w)
+	s.start(w)
+}
+
+// start runs a new instance of w. The caller must hold s.mu.
+func (s *HeartbeatSupervisor) start(w *supervisedWorker) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	w.generation++
+	gen := w.generation
+	w.status, w.started, w.lastBeat, w.cancel = Starting, s.clock.Now(), time.Time{}, cancel
+	s.running[w.name]++
+
+	run := w.factory()
+	go func() {
+		reason := "returned"
+		defer func() {
+			if r := recover(); r != nil {
+				reason = fmt.Sprint("panicked: ", r)
+			}
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.running[w.name]--
+			s.changed.Broadcast()
+			if gen == w.generation && s.ctx.Err() == nil {
+				s.markUnhealthy(w, reason)
+			}
+		}()
+		run(ctx, func() { s.beat(w, gen) })
+	}()
+}
+
+// beat records a heartbeat from instance gen of w.
+func (s *HeartbeatSupervisor) beat(w *supervisedWorker, gen int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if gen != w.generation {
+		return // an abandoned instance
+	}
+	w.lastBeat = s.clock.Now()
+	if w.status != Healthy {
+		w.status = Healthy
+		s.logf("%s: healthy", w.name)
+	}
+	s.changed.Broadcast()
+}
+
+// markUnhealthy abandons the current instance of w. The caller must hold s.mu.
+func (s *HeartbeatSupervisor) markUnhealthy(w *supervisedWorker, reason string) {
+	w.cancel()
+	w.generation++
+	w.status, w.reason = Unhealthy, reason
+	w.restartAt = s.clock.Now().Add(w.opts.RestartDelay)
+	s.logf("%s: unhealthy: %s", w.name, reason)
+}
+
+// loop checks the workers on every tick until Stop.
+func (s *HeartbeatSupervisor) loop(ticker clock.Ticker) {
+	defer close(s.done)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C():
+			s.check()
+		}
+	}
+}
+
+// check marks workers that missed their beats and restarts those whose
+// restart delay has passed.
+func (s *HeartbeatSupervisor) check() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	for _, w := range s.workers {
+		switch w.status {
+		case Starting, Healthy:
+			last := w.lastBeat
+			if last.IsZero() {
+				last = w.started
+			}
+			if missed := int(now.Sub(last) / w.opts.Interval); missed >= w.opts.MaxMissed {
+				s.markUnhealthy(w, fmt.Sprintf("missed %d heartbeats", missed))
+			}
+		case Unhealthy:
+			if !now.Before(w.restartAt) {
+				w.restarts++
+				s.logf("%s: restart %d", w.name, w.restarts)
+				s.start(w)
+			}
+		}
+	}
+	s.checks++
+	s.changed.Broadcast()
+}
+
+// waitUntil blocks until cond, called with s.mu held, returns true. Demos
+// and tests on a fake clock use it to let the supervisor catch up with
+// Advance.
+func (s *HeartbeatSupervisor) waitUntil(cond func() bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for !cond() {
+		s.changed.Wait()
+	}
+}
+
+// Stop cancels every worker and waits up to timeout (real time) for them to
+// return. It returns ErrTimeout naming the workers that did not.
+func (s *HeartbeatSupervisor) Stop(timeout time.Duration) error {
+	s.cancel()
+	<-s.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := waitCond(ctx, s.changed, func() bool {
+		for _, n := range s.running {
+			if n > 0 {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		var stuck []string
+		for name, n := range s.running {
+			if n > 0 {
+				stuck = append(stuck, fmt.Sprintf("%s (%d)", name, n))
+			}
+		}
+		sort.Strings(stuck)
+		return fmt.Errorf("workers still running: %s: %w", strings.Join(stuck, ", "), ErrTimeout)
+	}
+	return nil
+}
+
+// ==============================
+// Health Endpoint
+// ==============================
+
+// WorkerHealth is one worker in a HealthReport.
+type WorkerHealth struct {
+	Name      string `json:"name"`
+	Status    string `json:"status"`
+	SinceBeat string `json:"since_last_beat,omitempty"`
+	Restarts  int    `json:"restarts"`
+	Reason    string `json:"last_failure,omitempty"`
+}
+
+// HealthReport is the aggregated health served at /healthz. The supervisor
+// is healthy when no worker is unhealthy.
+type HealthReport struct {
+	Healthy bool           `json:"healthy"`
+	Workers []WorkerHealth `json:"workers"`
+}
+
+// Health returns the current health of every worker.
+func (s *HeartbeatSupervisor) Health() HealthReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	report := HealthReport{Healthy: true}
+	for _, w := range s.workers {
+		h := WorkerHealth{Name: w.name, Status: w.status.String(), Restarts: w.restarts, Reason: w.reason}
+		if !w.lastBeat.IsZero() && w.status != Unhealthy {
+			h.SinceBeat = now.Sub(w.lastBeat).String()
+		}
+		if w.status == Unhealthy {
+			report.Healthy = false
+		}
+		report.Workers = append(report.Workers, h)
+	}
+	return report
+}
+
+// Handler serves the HealthReport as JSON at /healthz, with status 200 when
+// healthy and 503 otherwise, as load balancers and Kubernetes probes expect.
+func (s *HeartbeatSupervisor) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter, r *http.Request) {
+		report := s.Health()
+		rw.Header().Set("Content-Type", "application/json")
+		if !report.Healthy {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(rw).Encode(report)
+	})
+	return mux
+}
+
+// ==============================
+// Example
+// ==============================
+
+// boringWorker is boringUntil with a heartbeat instead of printing: one
+// beat per second of clk's time.
+func boringWorker(clk clock.Clock) HeartbeatWorker {
+	return func(ctx context.Context, beat func()) {
+		for {
+			beat()
+			select {
+			case <-clk.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// generatorWorker is Generator with its pause taken from clk, so a fake
+// clock drives it too. It beats for every message it reads.
+func generatorWorker(clk clock.Clock, msg string) HeartbeatWorker {
+	return func(ctx context.Context, beat func()) {
+		c := make(chan string)
+		go func() {
+			defer close(c)
+			for i := 0; ; i++ {
+				select {
+				case c <- fmt.Sprintf("%s %d", msg, i):
+				case <-ctx.Done():
+					return
+				}
+				select {
+				case <-clk.After(500 * time.Millisecond):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		for range c {
+			beat()
+		}
+	}
+}
+
+// stuckWorker beats a few times, then waits forever for something that
+// never comes, the way a goroutine blocked on a lost channel does. It still
+// watches ctx, so the supervisor can cancel it.
+func stuckWorker(clk clock.Clock, beats int) HeartbeatWorker {
+	return func(ctx context.Context, beat func()) {
+		for i := 0; i < beats; i++ {
+			beat()
+			select {
+			case <-clk.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+		}
+		never := make(chan struct{})
+		select {
+		case <-never:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// getHealthz prints the status code and body of GET /healthz.
+func getHealthz(url string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		fmt.Println("GET /healthz:", err)
+		return
+	}
+	defer resp.Body.Close()
+	var report HealthReport
+	json.NewDecoder(resp.Body).Decode(&report)
+	var parts []string
+	for _, w := range report.Workers {
+		parts = append(parts, fmt.Sprintf("%s=%s", w.Name, w.Status))
+	}
+	fmt.Printf("GET /healthz: %d %s\n", resp.StatusCode, strings.Join(parts, " "))
+}
+
+// TestHeartbeatSupervisor supervises boring, a generator and a worker that
+// gets stuck after three beats, on a fake clock: a minute of supervision
+// takes a fraction of a second, and /healthz is queried over real HTTP.
+func TestHeartbeatSupervisor() {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	sup := NewHeartbeatSupervisor(fake, time.Second)
+	sup.Logf = func(format string, args ...any) {
+		fmt.Printf("%s  %s\n", fake.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+	}
+
+	// Register the workers one at a time, each once it has beaten, so they
+	// turn healthy in a fixed order.
+	opts := HeartbeatOptions{Interval: time.Second, MaxMissed: 3, RestartDelay: 5 * time.Second}
+	register := func(name string, factory func() HeartbeatWorker) {
+		sup.Register(name, opts, factory)
+		sup.waitUntil(func() bool { return sup.workers[len(sup.workers)-1].status == Healthy })
+	}
+	register("boring", func() HeartbeatWorker { return boringWorker(fake) })
+	register("generator", func() HeartbeatWorker { return generatorWorker(fake, "gen") })
+	instances := 0
+	register("stuck", func() HeartbeatWorker {
+		instances++
+		if instances == 1 {
+			return stuckWorker(fake, 3) // the first instance hangs
+		}
+		return boringWorker(fake)
+	})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	server := &http.Server{Handler: sup.Handler()}
+	go server.Serve(l)
+	defer server.Close()
+	url := "http://" + l.Addr().String() + "/healthz"
+
+	// Move the fake clock one second at a time. After each second, wait for
+	// the supervisor's check, then until the supervisor's ticker and the
+	// given number of workers wait on the clock again: every worker has
+	// beaten and is ready for the next second.
+	checks := 0
+	step := func(seconds, waiting int) {
+		for i := 0; i < seconds; i++ {
+			fake.Advance(time.Second)
+			checks++
+			sup.waitUntil(func() bool { return sup.checks >= checks })
+			fake.BlockUntil(1 + waiting)
+		}
+	}
+	fake.BlockUntil(1 + 3)
+	step(2, 3)
+	getHealthz(url)
+	step(3, 2) // stuck beats at 0s, 1s and 2s, then hangs; it has missed 3 beats at 5s
+	getHealthz(url)
+	step(4, 2)
+	step(2, 3) // restarted after RestartDelay, at 10s
+	getHealthz(url)
+	fmt.Println("stop:", sup.Stop(time.Second))
+	// Example Output:
+	// 09:00:00  boring: healthy
+	// 09:00:00  generator: healthy
+	// 09:00:00  stuck: healthy
+	// GET /healthz: 200 boring=healthy generator=healthy stuck=healthy
+	// 09:00:05  stuck: unhealthy: missed 3 heartbeats
+	// GET /healthz: 503 boring=healthy generator=healthy stuck=unhealthy
+	// 09:00:10  stuck: restart 1
+	// 09:00:10  stuck: healthy
+	// GET /healthz: 200 boring=healthy generator=healthy stuck=healthy
+	// stop: <nil>
+}
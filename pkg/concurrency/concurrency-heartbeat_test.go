@@ -0,0 +1,76 @@
+// concurrency-heartbeat_test.go
+//
+// Tests for the heartbeat supervisor in concurrency-heartbeat.go, on a fake
+// clock.
+
+package concurrency
+
+import (
+	"testing"
+	"time"
+
+	"Golan-Concepts/pkg/clock"
+)
+
+func TestHeartbeatRegisterRejectsNonPositiveInterval(t *testing.T) {
+	sup := NewHeartbeatSupervisor(clock.NewFake(time.Now()), time.Second)
+	defer sup.Stop(time.Second)
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Register with Interval %v did not panic", interval)
+				}
+			}()
+			sup.Register("w", HeartbeatOptions{Interval: interval}, func() HeartbeatWorker { return boringWorker(nil) })
+		}()
+	}
+	if n := len(sup.Health().Workers); n != 0 {
+		t.Fatalf("%d workers registered, want 0", n)
+	}
+}
+
+func TestHeartbeatRestartsStuckWorker(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC))
+	sup := NewHeartbeatSupervisor(fake, time.Second)
+	opts := HeartbeatOptions{Interval: time.Second, MaxMissed: 2, RestartDelay: 3 * time.Second}
+	instances := 0
+	sup.Register("stuck", opts, func() HeartbeatWorker {
+		instances++
+		if instances == 1 {
+			return stuckWorker(fake, 1)
+		}
+		return boringWorker(fake)
+	})
+
+	fake.BlockUntil(2) // the supervisor's ticker and the worker's first wait
+
+	checks := 0
+	status := func(seconds int) WorkerHealth {
+		for i := 0; i < seconds; i++ {
+			fake.Advance(time.Second)
+			checks++
+			sup.waitUntil(func() bool { return sup.checks >= checks })
+		}
+		return sup.Health().Workers[0]
+	}
+	// The worker beats at 0s and hangs at 1s; at 2s it has missed 2 beats.
+	if h := status(1); h.Status != "healthy" {
+		t.Fatalf("at 1s: %+v, want healthy", h)
+	}
+	if h := status(1); h.Status != "unhealthy" || h.Reason != "missed 2 heartbeats" {
+		t.Fatalf("at 2s: %+v, want unhealthy after 2 missed beats", h)
+	}
+	if h := status(2); h.Status != "unhealthy" || h.Restarts != 0 {
+		t.Fatalf("at 4s: %+v, want unhealthy, not yet restarted", h)
+	}
+	status(1)
+	sup.waitUntil(func() bool { return sup.workers[0].status == Healthy })
+	if h := sup.Health().Workers[0]; h.Restarts != 1 {
+		t.Fatalf("at 5s: %+v, want 1 restart", h)
+	}
+	if err := sup.Stop(time.Second); err != nil {
+		t.Fatalf("Stop: %v", err)
+	}
+}
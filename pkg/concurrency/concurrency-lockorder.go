@@ -0,0 +1,428 @@
+// concurrency-lockorder.go
+//
+// This file provides lock-order tracking mutexes that detect potential
+// deadlocks, even when the deadlock does not actually happen during a run.
+
+package concurrency
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ==============================
+// Why Lock Ordering Matters
+// ==============================
+//
+// The classic AB/BA deadlock looks like this:
+//
+//     Goroutine 1: lock(A) -> lock(B)
+//     Goroutine 2: lock(B) -> lock(A)
+//
+// If both goroutines grab their first lock at the same time, each one waits
+// forever for the other. Most of the time the timing works out and the program
+// runs fine, which is exactly why these bugs are so hard to find.
+//
+// A lock-order tracker records, for every goroutine, which locks are already
+// held when another lock is acquired. Each "held A while acquiring B" becomes an
+// edge A -> B in a global graph. A cycle in that graph means two code paths
+// disagree about the order of the locks, i.e. a potential deadlock, regardless
+// of whether this particular run was unlucky enough to hang.
+
+// ==============================
+// Tracked Mutexes
+// ==============================
+
+// TrackedMutex is a drop-in replacement for sync.Mutex that records lock
+// acquisition order. Name is optional and only used in reports.
+type TrackedMutex struct {
+	Name string
+	mu   sync.Mutex
+}
+
+// Lock records the acquisition and locks the mutex.
+func (m *TrackedMutex) Lock() {
+	pcs := callers()
+	lockOrder.beforeAcquire(m, m.Name, pcs)
+	m.mu.Lock()
+	lockOrder.acquired(m, m.Name, pcs)
+}
+
+// Unlock records the release and unlocks the mutex.
+func (m *TrackedMutex) Unlock() {
+	lockOrder.released(m)
+	m.mu.Unlock()
+}
+
+// TrackedRWMutex is a drop-in replacement for sync.RWMutex that records lock
+// acquisition order. Read locks are tracked as well: a pending writer blocks
+// new readers, so cycles through RLock can deadlock just like plain locks.
+type TrackedRWMutex struct {
+	Name string
+	mu   sync.RWMutex
+}
+
+// Lock records the acquisition and locks the mutex for writing.
+func (m *TrackedRWMutex) Lock() {
+	pcs := callers()
+	lockOrder.beforeAcquire(m, m.Name, pcs)
+	m.mu.Lock()
+	lockOrder.acquired(m, m.Name, pcs)
+}
+
+// Unlock records the release and unlocks the mutex for writing.
+func (m *TrackedRWMutex) Unlock() {
+	lockOrder.released(m)
+	m.mu.Unlock()
+}
+
+// RLock records the acquisition and locks the mutex for reading.
+func (m *TrackedRWMutex) RLock() {
+	pcs := callers()
+	lockOrder.beforeAcquire(m, m.Name, pcs)
+	m.mu.RLock()
+	lockOrder.acquired(m, m.Name, pcs)
+}
+
+// RUnlock records the release and unlocks the mutex for reading.
+func (m *TrackedRWMutex) RUnlock() {
+	lockOrder.released(m)
+	m.mu.RUnlock()
+}
+
+// ==============================
+// Lock-Order Graph
+// ==============================
+
+// heldLock is a lock currently held by a goroutine, with the stack that acquired it.
+type heldLock struct {
+	lock any
+	name string
+	pcs  []uintptr
+}
+
+// lockEdge records the first time `from` was held while `to` was acquired.
+type lockEdge struct {
+	from, to         any
+	fromName, toName string
+	fromPCs, toPCs   []uintptr
+	goroutine        int64
+}
+
+// LockOrderEdge is one step of a reported cycle: the goroutine held From
+// (acquired at FromStack) while acquiring To (at ToStack).
+type LockOrderEdge struct {
+	From, To           string
+	FromStack, ToStack string
+	Goroutine          int64
+}
+
+// LockOrderViolation describes a cycle in the lock-order graph.
+type LockOrderViolation struct {
+	Cycle []string
+	Edges []LockOrderEdge
+}
+
+// String formats the violation with the acquisition stacks of every edge.
+func (v LockOrderViolation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "potential deadlock: lock order cycle %s\n", strings.Join(v.Cycle, " -> "))
+	for _, e := range v.Edges {
+		fmt.Fprintf(&b, "\n  goroutine %d held %s, acquired at:\n%s", e.Goroutine, e.From, indent(e.FromStack))
+		fmt.Fprintf(&b, "  while acquiring %s at:\n%s", e.To, indent(e.ToStack))
+	}
+	return b.String()
+}
+
+// lockOrderGraph is the global bookkeeping shared by all tracked mutexes.
+type lockOrderGraph struct {
+	mu         sync.Mutex
+	held       map[int64][]heldLock
+	edges      map[any]map[any]*lockEdge
+	reported   map[string]bool
+	violations []LockOrderViolation
+	handler    func(LockOrderViolation)
+}
+
+var lockOrder = newLockOrderGraph()
+
+func newLockOrderGraph() *lockOrderGraph {
+	return &lockOrderGraph{
+		held:     make(map[int64][]heldLock),
+		edges:    make(map[any]map[any]*lockEdge),
+		reported: make(map[string]bool),
+	}
+}
+
+// beforeAcquire adds an edge from every lock the goroutine holds to the lock
+// it is about to acquire. It runs before blocking so that a real deadlock is
+// still reported.
+func (g *lockOrderGraph) beforeAcquire(lock any, name string, pcs []uintptr) {
+	gid := goroutineID()
+
+	g.mu.Lock()
+	var found []LockOrderViolation
+	for _, h := range g.held[gid] {
+		if g.edges[h.lock] == nil {
+			g.edges[h.lock] = make(map[any]*lockEdge)
+		}
+		if _, ok := g.edges[h.lock][lock]; ok {
+			continue
+		}
+		g.edges[h.lock][lock] = &lockEdge{
+			from: h.lock, to: lock,
+			fromName: lockName(h.lock, h.name), toName: lockName(lock, name),
+			fromPCs: h.pcs, toPCs: pcs,
+			goroutine: gid,
+		}
+		// The new edge h -> lock closes a cycle if lock already reaches h.
+		if path := g.path(lock, h.lock); path != nil {
+			if v, ok := g.violation(append(path, g.edges[h.lock][lock])); ok {
+				found = append(found, v)
+			}
+		}
+	}
+	handler := g.handler
+	g.mu.Unlock()
+
+	if handler != nil {
+		for _, v := range found {
+			handler(v)
+		}
+	}
+}
+
+// acquired pushes the lock onto the goroutine's held stack.
+func (g *lockOrderGraph) acquired(lock any, name string, pcs []uintptr) {
+	gid := goroutineID()
+	g.mu.Lock()
+	g.held[gid] = append(g.held[gid], heldLock{lock: lock, name: name, pcs: pcs})
+	g.mu.Unlock()
+}
+
+// released removes the lock from the goroutine that holds it. Go allows a
+// mutex to be unlocked by a different goroutine, so all goroutines are
+// searched if the current one does not hold it.
+func (g *lockOrderGraph) released(lock any) {
+	gid := goroutineID()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.removeHeld(gid, lock) {
+		return
+	}
+	for other := range g.held {
+		if g.removeHeld(other, lock) {
+			return
+		}
+	}
+}
+
+func (g *lockOrderGraph) removeHeld(gid int64, lock any) bool {
+	locks := g.held[gid]
+	for i := len(locks) - 1; i >= 0; i-- {
+		if locks[i].lock == lock {
+			locks = append(locks[:i], locks[i+1:]...)
+			if len(locks) == 0 {
+				delete(g.held, gid)
+			} else {
+				g.held[gid] = locks
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the edges of a path from -> ... -> to, or nil if none exists.
+func (g *lockOrderGraph) path(from, to any) []*lockEdge {
+	if from == to {
+		return []*lockEdge{}
+	}
+	visited := map[any]bool{from: true}
+	var dfs func(node any) []*lockEdge
+	dfs = func(node any) []*lockEdge {
+		for next, e := range g.edges[node] {
+			if next == to {
+				return []*lockEdge{e}
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if rest := dfs(next); rest != nil {
+				return append([]*lockEdge{e}, rest...)
+			}
+		}
+		return nil
+	}
+	return dfs(from)
+}
+
+// violation builds a report for the cycle, skipping cycles already reported.
+func (g *lockOrderGraph) violation(cycle []*lockEdge) (LockOrderViolation, bool) {
+	var v LockOrderViolation
+	for _, e := range cycle {
+		v.Cycle = append(v.Cycle, e.fromName)
+		v.Edges = append(v.Edges, LockOrderEdge{
+			From:      e.fromName,
+			To:        e.toName,
+			FromStack: formatStack(e.fromPCs),
+			ToStack:   formatStack(e.toPCs),
+			Goroutine: e.goroutine,
+		})
+	}
+	v.Cycle = append(v.Cycle, v.Cycle[0])
+
+	key := cycleKey(v.Cycle[:len(v.Cycle)-1])
+	if g.reported[key] {
+		return v, false
+	}
+	g.reported[key] = true
+	g.violations = append(g.violations, v)
+	return v, true
+}
+
+// cycleKey rotates the cycle so it starts at its smallest name; the same
+// cycle discovered from a different starting lock maps to the same key.
+func cycleKey(names []string) string {
+	start := 0
+	for i, n := range names {
+		if n < names[start] {
+			start = i
+		}
+	}
+	rotated := append(append([]string{}, names[start:]...), names[:start]...)
+	return strings.Join(rotated, "->")
+}
+
+// ==============================
+// Reporting
+// ==============================
+
+// LockOrderViolations returns every potential deadlock detected so far.
+func LockOrderViolations() []LockOrderViolation {
+	lockOrder.mu.Lock()
+	defer lockOrder.mu.Unlock()
+	return append([]LockOrderViolation(nil), lockOrder.violations...)
+}
+
+// SetLockOrderHandler installs a callback invoked as soon as a new cycle is
+// found. Pass nil to remove it.
+func SetLockOrderHandler(handler func(LockOrderViolation)) {
+	lockOrder.mu.Lock()
+	lockOrder.handler = handler
+	lockOrder.mu.Unlock()
+}
+
+// ResetLockOrder clears the graph and all recorded violations, so that each
+// test can start from a clean slate. Locks held at the time of the reset are
+// forgotten as well.
+func ResetLockOrder() {
+	fresh := newLockOrderGraph()
+	lockOrder.mu.Lock()
+	lockOrder.held = fresh.held
+	lockOrder.edges = fresh.edges
+	lockOrder.reported = fresh.reported
+	lockOrder.violations = nil
+	lockOrder.mu.Unlock()
+}
+
+// ==============================
+// Helpers
+// ==============================
+
+// goroutineID parses the current goroutine's ID from its stack header
+// ("goroutine 42 [running]:"). The runtime deliberately does not expose it,
+// so this is only meant for debugging tools like the ones in this package.
+func goroutineID() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	field := bytes.Fields(buf[:n])[1]
+	id, err := strconv.ParseInt(string(field), 10, 64)
+	if err != nil {
+		panic("cannot parse goroutine id: " + err.Error())
+	}
+	return id
+}
+
+// callers captures the stack of whoever called Lock/RLock.
+func callers() []uintptr {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	return pcs[:n]
+}
+
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func lockName(lock any, name string) string {
+	if name != "" {
+		return name
+	}
+	return fmt.Sprintf("%p", lock)
+}
+
+func indent(s string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	for i, l := range lines {
+		lines[i] = "    " + l
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// ==============================
+// Lock-Order Tracking Example
+// ==============================
+
+// TestLockOrderTracking acquires two locks in opposite orders from two
+// goroutines. The goroutines run one after another, so nothing hangs, but the
+// tracker still reports the AB/BA cycle with both acquisition stacks.
+func TestLockOrderTracking() {
+	ResetLockOrder()
+
+	a := &TrackedMutex{Name: "A"}
+	b := &TrackedMutex{Name: "B"}
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		a.Lock()
+		b.Lock()
+		fmt.Println("Goroutine 1: holds A then B")
+		b.Unlock()
+		a.Unlock()
+	}()
+	wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		b.Lock()
+		a.Lock()
+		fmt.Println("Goroutine 2: holds B then A")
+		a.Unlock()
+		b.Unlock()
+	}()
+	wg.Wait()
+
+	for _, v := range LockOrderViolations() {
+		fmt.Println(v)
+	}
+	// Output starts with:
+	// potential deadlock: lock order cycle A -> B -> A
+}
@@ -7,6 +7,7 @@ package concurrency
 
 import (
 	"fmt"
+	"os"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -91,24 +92,22 @@ func workerWithMutex(wg *sync.WaitGroup) {
 	}
 }
 
-// SafeCounter is a thread-safe counter using mutex for synchronization.
+// SafeCounter is a thread-safe counter. The value lives in a Guarded, so it
+// cannot be reached without the lock, and the demo can still report how
+// contended the lock was.
+// pkg/actor has the same counter without a mutex (actor.NewCounter), for comparison.
 type SafeCounter struct {
-	mu    sync.Mutex
-	value int
+	value Guarded[int]
 }
 
 // Increment safely increments the counter.
 func (c *SafeCounter) Increment() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.value++
+	c.value.With(func(v *int) { *v++ })
 }
 
 // Value safely retrieves the current counter value.
 func (c *SafeCounter) Value() int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.value
+	return c.value.Load()
 }
 
 // TestMutex demonstrates the difference between using mutexes and not using them.
@@ -130,6 +129,7 @@ func TestMutex() {
 	// Explanation:
 	// Expected counter is 5000 (5 workers * 1000 increments).
 	// Due to race conditions, the final counter is likely less than 5000.
+	// pkg/interleave replays the exact interleaving that loses an update.
 
 	// Reset counter for mutex-protected example
 	counter = 0
@@ -151,6 +151,10 @@ func TestMutex() {
 	// SafeCounter Example
 	// ==============================
 
+	SetContentionProfiling(true)
+	defer SetContentionProfiling(false)
+	ResetContentionProfile()
+
 	safeCounter := SafeCounter{}
 	for i := 0; i < 5; i++ {
 		wg.Add(1)
@@ -165,38 +169,47 @@ func TestMutex() {
 	wg.Wait()
 	fmt.Println("Final SafeCounter:", safeCounter.Value())
 	// Expected Output: Final SafeCounter: 5000
+
+	// The final count only proves correctness; the contention report shows
+	// how long the five goroutines spent waiting on each other.
+	WriteContentionReport(os.Stdout, 3)
 }
 
 // ==============================
 // Read-Write Mutex Example
 // ==============================
 
-// ReadHeavyStruct demonstrates the use of sync.RWMutex for read-heavy scenarios.
+// ReadHeavyStruct demonstrates a read-write lock for read-heavy scenarios:
+// Guarded.Read takes the read lock, Guarded.With the write lock.
 type ReadHeavyStruct struct {
-	mu   sync.RWMutex
-	data map[string]string
+	data Guarded[map[string]string]
 }
 
 // Read retrieves data with a read lock.
-func (r *ReadHeavyStruct) Read(key string) (string, bool) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-	val, exists := r.data[key]
+func (r *ReadHeavyStruct) Read(key string) (val string, exists bool) {
+	r.data.Read(func(data map[string]string) {
+		val, exists = data[key]
+	})
 	return val, exists
 }
 
 // Write modifies data with a write lock.
 func (r *ReadHeavyStruct) Write(key string, value string) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-	r.data[key] = value
+	r.data.With(func(data *map[string]string) {
+		if *data == nil {
+			*data = make(map[string]string)
+		}
+		(*data)[key] = value
+	})
 }
 
 // TestRWMutex demonstrates the usage of sync.RWMutex.
 func TestRWMutex() {
-	rhs := ReadHeavyStruct{
-		data: make(map[string]string),
-	}
+	SetContentionProfiling(true)
+	defer SetContentionProfiling(false)
+	ResetContentionProfile()
+
+	rhs := ReadHeavyStruct{}
 	var wg sync.WaitGroup
 
 	// Writer goroutine
@@ -228,7 +241,11 @@ func TestRWMutex() {
 	}
 
 	wg.Wait()
-	fmt.Println("Final Map:", rhs.data)
+	fmt.Println("Final Map:", rhs.data.Load())
+	// Readers rarely wait: they only block while the writer holds the lock.
+	// With a single slow writer there is no starvation to see; see
+	// TestWriterStarvation for what happens under heavy read load.
+	WriteContentionReport(os.Stdout, 3)
 }
 
 // ==============================
@@ -281,6 +298,7 @@ func deadlockExample() {
 	}()
 	wg.Wait()
 	// The program will deadlock here
+	// (deadlockExampleFailFast shows the same bug with a lock that can time out.)
 }
 
 // ==============================
@@ -319,30 +337,29 @@ func properLockingExample() {
 // SafeQueue Example
 // ==============================
 
-// SafeQueue is a thread-safe queue implemented using a mutex.
+// SafeQueue is a thread-safe queue implemented on a Guarded slice.
 type SafeQueue struct {
-	mu    sync.Mutex
-	queue []int
+	queue Guarded[[]int]
 }
 
 // Enqueue adds an item to the queue.
 func (sq *SafeQueue) Enqueue(item int) {
-	sq.mu.Lock()
-	defer sq.mu.Unlock()
-	sq.queue = append(sq.queue, item)
+	sq.queue.With(func(q *[]int) {
+		*q = append(*q, item)
+	})
 }
 
 // Dequeue removes and returns an item from the queue.
 // Returns false if the queue is empty.
-func (sq *SafeQueue) Dequeue() (int, bool) {
-	sq.mu.Lock()
-	defer sq.mu.Unlock()
-	if len(sq.queue) == 0 {
-		return 0, false
-	}
-	item := sq.queue[0]
-	sq.queue = sq.queue[1:]
-	return item, true
+func (sq *SafeQueue) Dequeue() (item int, ok bool) {
+	sq.queue.With(func(q *[]int) {
+		if len(*q) == 0 {
+			return
+		}
+		item, ok = (*q)[0], true
+		*q = (*q)[1:]
+	})
+	return item, ok
 }
 
 // producer adds items to the SafeQueue.
@@ -368,6 +385,10 @@ func consumer(sq *SafeQueue, wg *sync.WaitGroup) {
 
 // TestSafeQueue demonstrates using mutexes with channels and WaitGroups.
 func TestSafeQueue() {
+	SetContentionProfiling(true)
+	defer SetContentionProfiling(false)
+	ResetContentionProfile()
+
 	sq := SafeQueue{}
 	var wg sync.WaitGroup
 
@@ -381,6 +402,7 @@ func TestSafeQueue() {
 
 	wg.Wait()
 	fmt.Println("Producer and Consumer completed.")
+	WriteContentionReport(os.Stdout, 3)
 }
 
 // ==============================
@@ -429,12 +451,25 @@ func main() {
 	TestRWMutex()
 	fmt.Println()
 
+	TestWriterStarvation()
+	fmt.Println()
+
 	TestAtomicCounter()
 	fmt.Println()
 
+	TestCounters()
+	fmt.Println()
+
+	TestGuarded()
+	fmt.Println()
+
 	// Uncomment the following line to see a deadlock (program will hang)
 	// deadlockExample()
 
+	// The same mistake with a CtxMutex fails fast instead of hanging.
+	TestCtxMutex()
+	fmt.Println()
+
 	properLockingExample()
 	fmt.Println()
 
@@ -443,4 +478,7 @@ func main() {
 
 	// Uncomment the following line to see deadlock prevention
 	// TestDeadlockPrevention()
+
+	TestLockOrderTracking()
+	fmt.Println()
 }
@@ -1,9 +1,15 @@
 package concurrency
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
+
+	"Golan-Concepts/pkg/leakcheck"
+	"Golan-Concepts/pkg/shutdown"
 )
 
 //Concurrency Patterns
@@ -12,48 +18,395 @@ import (
 //A generator is a function that returns a channel.
 //It encapsulates the creation of a goroutine and the communication channel.
 
-func generatorWithBoring(msg string) <-chan string {
+//Like every long-running demo, the generator runs under a shutdown coordinator (pkg/shutdown):
+//its goroutine is registered with coord.Go and stops when the coordinator shuts down,
+//instead of blocking on a send forever.
+
+func generatorWithBoring(coord *shutdown.Coordinator, msg string) <-chan string {
 	c := make(chan string)
-	go func() {
+	coord.Go(msg, func(ctx context.Context) {
 		for i := 0; ; i++ {
-			c <- fmt.Sprintf("%s %d", msg, i)
-			time.Sleep(time.Millisecond * time.Duration(rand.Intn(1e3)))
+			select {
+			case c <- fmt.Sprintf("%s %d", msg, i):
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-time.After(time.Millisecond * time.Duration(rand.Intn(1e3))):
+			case <-ctx.Done():
+				return
+			}
 		}
-	}()
+	})
 	return c
 }
 
-func testGeneratorWithBoring() {
-	c := generatorWithBoring("boring!")
-	for i := 0; i < 5; i++ {
-		fmt.Println(<-c)
+// receiveN prints n messages from c, or fewer if ctx is cancelled first (Ctrl+C).
+func receiveN(ctx context.Context, c <-chan string, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case msg := <-c:
+			fmt.Println(msg)
+		case <-ctx.Done():
+			return
+		}
 	}
+}
+
+func testGeneratorWithBoring() {
+	coord, stop := newDemoCoordinator()
+	defer stop()
+
+	receiveN(coord.Context(), generatorWithBoring(coord, "boring!"), 5)
 	fmt.Println("You're boring; I'm leaving.")
+	coord.Shutdown(time.Second)
 }
 
 //Fan-In Pattern
 //Fan-In combines multiple channels into a single channel.
 //Allows you to receive from multiple goroutines and handle their messages on a single channel.
 
-func fanIn(input1, input2 <-chan string) <-chan string {
+func fanIn(coord *shutdown.Coordinator, input1, input2 <-chan string) <-chan string {
 	c := make(chan string)
-	go func() {
+	forward := func(ctx context.Context, input <-chan string) {
 		for {
-			c <- <-input1
+			select {
+			case msg := <-input:
+				select {
+				case c <- msg:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+	coord.Go("fan-in 1", func(ctx context.Context) { forward(ctx, input1) })
+	coord.Go("fan-in 2", func(ctx context.Context) { forward(ctx, input2) })
+	return c
+}
+
+func testFanIn() {
+	coord, stop := newDemoCoordinator()
+	defer stop()
+
+	c := fanIn(coord, generatorWithBoring(coord, "Joe"), generatorWithBoring(coord, "Ann"))
+	receiveN(coord.Context(), c, 10)
+	fmt.Println("You're both boring; I'm leaving.")
+	coord.Shutdown(time.Second)
+}
+
+//Without the coordinator, the generator and fan-in above would never stop: once the caller stops
+//reading, their goroutines stay blocked on a send forever (a goroutine leak). A coordinator that is
+//never shut down is no better, as TestLeaks shows. The patterns below all come from the same talk and
+//each one shuts down cleanly on its own: every goroutine it starts has a way to exit.
+
+//2- Generator With Quit
+//A quit channel tells the generator to stop. Closing it works for any number of listeners,
+//and the generator closes its output so a range loop over it ends too.
+
+// Generator sends "msg 0", "msg 1", ... until quit is closed, then closes the returned channel.
+func Generator(msg string, quit <-chan struct{}) <-chan string {
+	c := make(chan string)
+	go func() {
+		defer close(c)
+		for i := 0; ; i++ {
+			select {
+			case c <- fmt.Sprintf("%s %d", msg, i):
+			case <-quit:
+				return
+			}
+			select {
+			case <-time.After(time.Millisecond * time.Duration(rand.Intn(1e2))):
+			case <-quit:
+				return
+			}
 		}
 	}()
+	return c
+}
+
+// The quit channel can also come from a shutdown coordinator: ctx.Done() is a <-chan struct{}
+// that is closed on Ctrl+C, so the generator stops together with the rest of the program.
+func testGeneratorWithShutdown() {
+	coord, stop := newDemoCoordinator()
+	defer stop()
+
+	coord.Go("Joe", func(ctx context.Context) {
+		for msg := range Generator("Joe", ctx.Done()) {
+			fmt.Println(msg)
+		}
+	})
+	time.Sleep(time.Second)
+	fmt.Println(coord.Shutdown(time.Second))
+}
+
+//3- Timeout Using Select
+//time.After returns a channel that delivers a value after the duration.
+//Creating it inside the loop gives each message its own timeout;
+//creating it once outside the loop gives the whole conversation a deadline.
+
+// ErrTimeout is returned when a receive does not complete in time.
+var ErrTimeout = errors.New("timed out")
+
+// ReceiveEach reads n messages from c, failing if any single message takes longer than perMessage.
+func ReceiveEach(c <-chan string, n int, perMessage time.Duration) ([]string, error) {
+	var msgs []string
+	for i := 0; i < n; i++ {
+		select {
+		case msg, ok := <-c:
+			if !ok {
+				return msgs, nil
+			}
+			msgs = append(msgs, msg)
+		case <-time.After(perMessage):
+			return msgs, fmt.Errorf("message %d: %w", i, ErrTimeout)
+		}
+	}
+	return msgs, nil
+}
+
+// ReceiveFor reads messages from c until it is closed or the overall timeout expires.
+func ReceiveFor(c <-chan string, overall time.Duration) ([]string, error) {
+	var msgs []string
+	timeout := time.NewTimer(overall)
+	defer timeout.Stop()
+	for {
+		select {
+		case msg, ok := <-c:
+			if !ok {
+				return msgs, nil
+			}
+			msgs = append(msgs, msg)
+		case <-timeout.C:
+			return msgs, ErrTimeout
+		}
+	}
+}
+
+// stallAfter sends "msg 0" ... "msg n-1" as fast as they are read, then goes quiet
+// until quit is closed, like a backend that hangs. Unlike Generator its timing is fixed,
+// so the timeouts below always trip at the same message.
+func stallAfter(msg string, n int, quit <-chan struct{}) <-chan string {
+	c := make(chan string)
 	go func() {
-		for {
-			c <- <-input2
+		defer close(c)
+		for i := 0; i < n; i++ {
+			select {
+			case c <- fmt.Sprintf("%s %d", msg, i):
+			case <-quit:
+				return
+			}
+		}
+		<-quit
+	}()
+	return c
+}
+
+func testTimeouts() {
+	quit := make(chan struct{})
+	defer close(quit)
+
+	msgs, err := ReceiveEach(stallAfter("Joe", 3, quit), 5, 80*time.Millisecond)
+	fmt.Println(msgs, err) // The fourth message never comes, so its own 80ms timeout trips.
+
+	msgs, err = ReceiveFor(stallAfter("Ann", 4, quit), 300*time.Millisecond)
+	fmt.Println(len(msgs), "messages before", err) // The channel is never closed, so the deadline ends it.
+	//[Joe 0 Joe 1 Joe 2] message 3: timed out
+	//4 messages before timed out
+}
+
+//4- Quit Channel With Cleanup Handshake
+//Sometimes the caller must know the goroutine has finished cleaning up before moving on.
+//The caller sends on quit and then waits for a reply on the same channel.
+
+// BoringWithCleanup sends messages until it receives on quit. It then runs cleanup and
+// replies on quit, so the caller knows cleanup is complete.
+func BoringWithCleanup(msg string, quit chan string, cleanup func()) <-chan string {
+	c := make(chan string)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case c <- fmt.Sprintf("%s %d", msg, i):
+			case <-quit:
+				cleanup()
+				quit <- "See you!"
+				return
+			}
 		}
 	}()
 	return c
 }
 
-func main() {
-	c := fanIn(generatorWithBoring("Joe"), generatorWithBoring("Ann"))
-	for i := 0; i < 10; i++ {
+func testQuitHandshake() {
+	quit := make(chan string)
+	c := BoringWithCleanup("Joe", quit, func() { fmt.Println("Joe: cleaning up") })
+	for i := 0; i < 3; i++ {
 		fmt.Println(<-c)
 	}
-	fmt.Println("You're both boring; I'm leaving.")
+	quit <- "Bye!"
+	fmt.Printf("Joe says: %q\n", <-quit)
+	//Joe 0
+	//Joe 1
+	//Joe 2
+	//Joe: cleaning up
+	//Joe says: "See you!"
+}
+
+//5- Daisy-Chain
+//A chain of goroutines, each passing a value to its left neighbour plus one, like a game of whispers.
+//Goroutines are cheap enough that a chain of 100,000 finishes in well under a second.
+//Every goroutine sends exactly once and returns, so nothing leaks.
+
+// DaisyChain builds a chain of n goroutines, feeds 1 into the right end and returns what comes out the left end (n+1).
+func DaisyChain(n int) int {
+	whisper := func(left chan<- int, right <-chan int) {
+		left <- 1 + <-right
+	}
+	leftmost := make(chan int)
+	right := leftmost
+	left := leftmost
+	for i := 0; i < n; i++ {
+		right = make(chan int)
+		go whisper(left, right)
+		left = right
+	}
+	go func(c chan<- int) { c <- 1 }(right)
+	return <-leftmost
+}
+
+func testDaisyChain() {
+	fmt.Println(DaisyChain(100000)) // 100001
+}
+
+//6- Google Search: Replicated Query, First Response Wins
+//Send the same query to several replicas and use whichever answers first.
+//The result channel is buffered to the number of replicas so the slower ones can still
+//send and exit; with an unbuffered channel every loser would leak.
+
+// SearchResult is a single search hit.
+type SearchResult string
+
+// Search is any backend that answers a query.
+type Search func(query string) SearchResult
+
+// FakeSearch returns a backend that answers after a random delay of up to 100ms.
+func FakeSearch(kind string) Search {
+	return func(query string) SearchResult {
+		time.Sleep(time.Duration(rand.Intn(100)) * time.Millisecond)
+		return SearchResult(fmt.Sprintf("%s result for %q", kind, query))
+	}
+}
+
+// First queries every replica and returns the first answer.
+func First(query string, replicas ...Search) SearchResult {
+	c := make(chan SearchResult, len(replicas))
+	for _, replica := range replicas {
+		go func(search Search) { c <- search(query) }(replica)
+	}
+	return <-c
+}
+
+// Google runs a web, image and video search in parallel, each against two replicas,
+// and returns whatever arrived before the overall timeout.
+func Google(query string, timeout time.Duration) ([]SearchResult, error) {
+	searches := [][]Search{
+		{FakeSearch("web"), FakeSearch("web2")},
+		{FakeSearch("image"), FakeSearch("image2")},
+		{FakeSearch("video"), FakeSearch("video2")},
+	}
+	c := make(chan SearchResult, len(searches))
+	for _, replicas := range searches {
+		go func(replicas []Search) { c <- First(query, replicas...) }(replicas)
+	}
+
+	var results []SearchResult
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for range searches {
+		select {
+		case result := <-c:
+			results = append(results, result)
+		case <-deadline.C:
+			return results, ErrTimeout
+		}
+	}
+	return results, nil
+}
+
+func testGoogle() {
+	start := time.Now()
+	results, err := Google("golang", 80*time.Millisecond)
+	fmt.Println(results, err, time.Since(start))
+}
+
+//7- Ping-Pong
+//Two players pass a ball over a table channel. Whoever holds the ball is the only one touching it,
+//so no mutex is needed. To stop, main takes the ball off the table (so no player is holding it)
+//and closes the table; both players see the close and return.
+
+// Ball counts how many times it has been hit.
+type Ball struct{ Hits int }
+
+func player(name string, table chan *Ball, wg *sync.WaitGroup, verbose bool) {
+	defer wg.Done()
+	for {
+		ball, ok := <-table
+		if !ok {
+			return
+		}
+		ball.Hits++
+		if verbose {
+			fmt.Println(name, ball.Hits)
+		}
+		time.Sleep(10 * time.Millisecond)
+		table <- ball
+	}
+}
+
+// PingPong plays for the given duration and returns the number of hits.
+// Both player goroutines have exited when it returns.
+func PingPong(d time.Duration, verbose bool) int {
+	table := make(chan *Ball)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go player("ping", table, &wg, verbose)
+	go player("pong", table, &wg, verbose)
+
+	table <- new(Ball) // game on; toss the ball
+	time.Sleep(d)
+	ball := <-table // game over; grab the ball
+	close(table)
+	wg.Wait()
+	return ball.Hits
+}
+
+func testPingPong() {
+	fmt.Println("hits:", PingPong(100*time.Millisecond, true))
+}
+
+// TestChannelPatterns runs every pattern above. None of them should leave goroutines behind.
+func TestChannelPatterns() {
+	testTimeouts()
+	testQuitHandshake()
+	testDaisyChain()
+	testGoogle()
+	testPingPong()
+}
+
+// TestLeaks runs the demos above under the leak checker (pkg/leakcheck).
+// Every demo shuts its coordinator down before returning, so all of them are clean.
+// To see what a leak looks like, the last check starts a generator under a
+// coordinator that is never shut down: once it stops being read, its goroutine
+// blocks on a send forever, and the checker prints its stack.
+func TestLeaks() {
+	opts := leakcheck.Options{Settle: time.Second}
+	leakcheck.Run("generatorWithBoring", testGeneratorWithBoring, opts) // no leaked goroutines
+	leakcheck.Run("fanIn", testFanIn, opts)                             // no leaked goroutines
+	leakcheck.Run("channel patterns", TestChannelPatterns, opts)        // no leaked goroutines
+	leakcheck.Run("never shut down", func() {
+		coord := shutdown.New(context.Background())
+		fmt.Println(<-generatorWithBoring(coord, "boring!"))
+	}, opts) // 1 leaked goroutine
 }
@@ -0,0 +1,110 @@
+// concurrency-patterns_test.go
+//
+// Tests for the channel patterns in concurrency-patterns.go. Each one checks
+// what a pattern returns and, where it starts goroutines, that they all exit.
+
+package concurrency
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"Golan-Concepts/pkg/leakcheck"
+)
+
+func TestGeneratorStopsOnQuit(t *testing.T) {
+	defer leakcheck.Verify(t, leakcheck.Options{})()
+
+	quit := make(chan struct{})
+	c := Generator("Joe", quit)
+	if got := <-c; got != "Joe 0" {
+		t.Fatalf("first message = %q, want %q", got, "Joe 0")
+	}
+	close(quit)
+	for range c {
+		// Drain until the generator closes c.
+	}
+}
+
+func TestReceiveEach(t *testing.T) {
+	quit := make(chan struct{})
+	defer close(quit)
+
+	msgs, err := ReceiveEach(stallAfter("Joe", 5, quit), 5, time.Second)
+	if err != nil || len(msgs) != 5 {
+		t.Fatalf("ReceiveEach = %v, %v; want 5 messages and no error", msgs, err)
+	}
+
+	msgs, err = ReceiveEach(stallAfter("Ann", 2, quit), 5, 20*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("ReceiveEach error = %v, want ErrTimeout", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("ReceiveEach got %v before the timeout, want 2 messages", msgs)
+	}
+}
+
+func TestReceiveFor(t *testing.T) {
+	quit := make(chan struct{})
+	c := stallAfter("Joe", 3, quit)
+	close(quit)
+	if msgs, err := ReceiveFor(c, time.Second); err != nil || len(msgs) > 3 {
+		t.Fatalf("ReceiveFor on a closed channel = %v, %v; want at most 3 messages and no error", msgs, err)
+	}
+
+	quit = make(chan struct{})
+	defer close(quit)
+	msgs, err := ReceiveFor(stallAfter("Ann", 3, quit), 20*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) || len(msgs) != 3 {
+		t.Fatalf("ReceiveFor = %v, %v; want 3 messages and ErrTimeout", msgs, err)
+	}
+}
+
+func TestBoringWithCleanupHandshake(t *testing.T) {
+	defer leakcheck.Verify(t, leakcheck.Options{})()
+
+	quit := make(chan string)
+	cleaned := false
+	c := BoringWithCleanup("Joe", quit, func() { cleaned = true })
+	<-c
+	quit <- "Bye!"
+	if reply := <-quit; reply != "See you!" {
+		t.Fatalf("reply = %q, want %q", reply, "See you!")
+	}
+	// The reply is sent after cleanup returns, so this read does not race.
+	if !cleaned {
+		t.Fatal("cleanup had not run when the reply arrived")
+	}
+}
+
+func TestDaisyChainAddsOnePerGoroutine(t *testing.T) {
+	defer leakcheck.Verify(t, leakcheck.Options{})()
+
+	if got := DaisyChain(1000); got != 1001 {
+		t.Fatalf("DaisyChain(1000) = %d, want 1001", got)
+	}
+}
+
+func TestFirstReturnsFastestReplica(t *testing.T) {
+	defer leakcheck.Verify(t, leakcheck.Options{})()
+
+	fast := func(q string) SearchResult { return "fast" }
+	slow := func(q string) SearchResult {
+		time.Sleep(50 * time.Millisecond)
+		return "slow"
+	}
+	if got := First("golang", slow, fast, slow); got != "fast" {
+		t.Fatalf("First = %q, want %q", got, "fast")
+	}
+	// The slow replicas still send into the buffered channel and exit,
+	// which the deferred leak check waits for.
+}
+
+func TestPingPongStopsPlayers(t *testing.T) {
+	defer leakcheck.Verify(t, leakcheck.Options{})()
+
+	if hits := PingPong(50*time.Millisecond, false); hits < 1 {
+		t.Fatalf("PingPong hits = %d, want at least 1", hits)
+	}
+}
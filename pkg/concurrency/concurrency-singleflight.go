@@ -0,0 +1,239 @@
+// concurrency-singleflight.go
+//
+// This file provides request deduplication (singleflight) and a generic lazy
+// initializer built on sync.Once.
+
+package concurrency
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ==============================
+// Request Deduplication
+// ==============================
+//
+// In callHttp every goroutine fetches its URL. If ten goroutines ask for the
+// same URL at the same moment, that is ten identical requests, and for a slow
+// or overloaded backend it is the worst possible moment to send them
+// (a "thundering herd" or "cache stampede").
+//
+// Singleflight coalesces them: the first caller for a key runs the function,
+// callers arriving while it is in flight wait for it, and all of them get the
+// same result and error. Once the call finishes, the next caller starts a new
+// one; nothing is cached.
+//
+//     goroutine 1: Do("a") ----[ fetch "a" ]----> result
+//     goroutine 2:   Do("a") ---- waits ------->  same result (shared)
+//     goroutine 3:     Do("a") -- waits ------->  same result (shared)
+
+// flight is one in-flight call.
+type flight[V any] struct {
+	wg    sync.WaitGroup
+	value V
+	err   error
+	dups  int
+}
+
+// Group deduplicates concurrent calls by key. The zero value is ready to use.
+type Group[K comparable, V any] struct {
+	mu      sync.Mutex
+	flights map[K]*flight[V]
+}
+
+// Do runs fn for key, unless a call for key is already in flight, in which
+// case it waits for that call and returns its result. shared reports whether
+// the result was given to more than one caller.
+func (g *Group[K, V]) Do(key K, fn func() (V, error)) (value V, err error, shared bool) {
+	g.mu.Lock()
+	if g.flights == nil {
+		g.flights = make(map[K]*flight[V])
+	}
+	if f, ok := g.flights[key]; ok {
+		f.dups++
+		g.mu.Unlock()
+		f.wg.Wait()
+		return f.value, f.err, true
+	}
+	f := &flight[V]{}
+	f.wg.Add(1)
+	g.flights[key] = f
+	g.mu.Unlock()
+
+	g.run(key, f, fn)
+	return f.value, f.err, f.dups > 0
+}
+
+// run executes fn and releases the waiters. If fn panics, waiters get an
+// error instead of hanging forever, and the panic continues in the caller.
+func (g *Group[K, V]) run(key K, f *flight[V], fn func() (V, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			f.err = fmt.Errorf("singleflight: call panicked: %v", r)
+			g.finish(key, f)
+			panic(r)
+		}
+	}()
+	f.value, f.err = fn()
+	g.finish(key, f)
+}
+
+func (g *Group[K, V]) finish(key K, f *flight[V]) {
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+	f.wg.Done()
+}
+
+// Forget makes the next Do for key start a new call even if one is in
+// flight. Callers already waiting still get the old call's result.
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	delete(g.flights, key)
+	g.mu.Unlock()
+}
+
+// ==============================
+// Lazy Initialization
+// ==============================
+//
+// sync.Once runs a function exactly once, no matter how many goroutines call
+// Do at the same time. Lazy[T] wraps it for the common case of an expensive
+// value (a connection, a parsed config) that should only be built on first use.
+//
+// Two details differ from a bare sync.Once:
+//
+// 1. Errors are cached too. If initialization fails, every Get returns the
+//    same error instead of retrying on each call. Call Reset to retry.
+// 2. Reset starts over with a fresh Once, which tests need so that one test's
+//    initialization does not leak into the next.
+
+// lazyState is one initialization attempt.
+type lazyState[T any] struct {
+	once  sync.Once
+	value T
+	err   error
+}
+
+// Lazy computes a value on first use. Create it with NewLazy.
+type Lazy[T any] struct {
+	mu    sync.Mutex
+	init  func() (T, error)
+	state *lazyState[T]
+}
+
+// NewLazy returns a Lazy that calls init on the first Get.
+func NewLazy[T any](init func() (T, error)) *Lazy[T] {
+	return &Lazy[T]{init: init, state: &lazyState[T]{}}
+}
+
+// Get returns the value, running init if this is the first call since
+// creation or the last Reset. Concurrent first calls wait for one init.
+func (l *Lazy[T]) Get() (T, error) {
+	l.mu.Lock()
+	s := l.state
+	l.mu.Unlock()
+
+	s.once.Do(func() {
+		s.value, s.err = l.init()
+	})
+	return s.value, s.err
+}
+
+// Reset forgets the cached value or error; the next Get runs init again.
+func (l *Lazy[T]) Reset() {
+	l.mu.Lock()
+	l.state = &lazyState[T]{}
+	l.mu.Unlock()
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// fetches is shared by callHttpDeduplicated's goroutines.
+var fetches Group[string, string]
+
+// callHttpDeduplicated is callHttp with many goroutines asking for the same
+// URLs. The group makes sure each URL is only fetched once at a time.
+func callHttpDeduplicated() {
+	urls := []string{
+		"https://www.google.com",
+		"https://www.github.com",
+		"https://www.golang.org",
+	}
+	var requests int64
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		for _, url := range urls {
+			wg.Add(1)
+			go func(url string) {
+				defer wg.Done()
+				status, err, shared := fetches.Do(url, func() (string, error) {
+					atomic.AddInt64(&requests, 1)
+					return fetchStatus(url)
+				})
+				if err != nil {
+					fmt.Printf("Error fetching %s: %v\n", url, err)
+					return
+				}
+				fmt.Printf("Fetched %s: %s (shared=%v)\n", url, status, shared)
+			}(url)
+		}
+	}
+	wg.Wait()
+	fmt.Printf("15 lookups, %d HTTP requests.\n", atomic.LoadInt64(&requests))
+}
+
+// TestSingleflight runs ten concurrent lookups of the same slow key.
+func TestSingleflight() {
+	var g Group[string, int]
+	var calls int64
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Do("answer", func() (int, error) {
+				atomic.AddInt64(&calls, 1)
+				time.Sleep(100 * time.Millisecond)
+				return 42, nil
+			})
+		}()
+	}
+	wg.Wait()
+	fmt.Println("lookups: 10, calls:", atomic.LoadInt64(&calls))
+	// Expected Output: lookups: 10, calls: 1
+}
+
+// TestLazy shows that Lazy initializes once, caches errors, and retries
+// after Reset.
+func TestLazy() {
+	attempts := 0
+	config := NewLazy(func() (string, error) {
+		attempts++
+		if attempts == 1 {
+			return "", fmt.Errorf("config server unavailable")
+		}
+		return "debug=true", nil
+	})
+
+	for i := 0; i < 3; i++ {
+		fmt.Println(config.Get())
+	}
+	config.Reset()
+	fmt.Println(config.Get())
+	fmt.Println(config.Get())
+	fmt.Println("attempts:", attempts)
+	//  config server unavailable
+	//  config server unavailable
+	//  config server unavailable
+	// debug=true <nil>
+	// debug=true <nil>
+	// attempts: 2
+}
@@ -1,10 +1,13 @@
 package concurrency
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"sync"
 	"time"
+
+	"Golan-Concepts/pkg/shutdown"
 )
 
 // Concurrency in Go
@@ -75,25 +78,73 @@ Go focuses on concurrency as a way to structure software that interacts with the
 
 //2. Goroutine Management
 //Scheduler: The Go runtime has its own scheduler that automatically assigns goroutines to threads, similar to how an operating system schedules threads for CPU execution.
+//To watch the scheduler's decisions (run queues, work stealing, syscall hand-off, preemption) step by step,
+//see the G-M-P simulator in pkg/scheduler, e.g. scheduler.TestWorkStealing().
 
 // 3.Syntax:
 // go functionName()
-func boring(msg string) {
-	for i := 0; ; i++ {
-		fmt.Println(msg, i)
-		time.Sleep(time.Second)
-	}
-}
+//
+// Long-running demos start their goroutines through a shutdown coordinator (newDemoCoordinator below);
+// coord.Go wraps the go statement and hands the goroutine a context to watch.
 func CallInMain() {
-	go boring("boring!")
+	coord, stop := newDemoCoordinator()
+	defer stop()
+
+	coord.Go("boring", func(ctx context.Context) { boringUntil(ctx, "boring!") })
 	fmt.Println("I'm listening.")
 	time.Sleep(2 * time.Second)
 	fmt.Println("You're boring; I'm leaving.")
+	coord.Shutdown(time.Second)
+}
+
+//In the example, boringUntil runs as a goroutine, printing messages.
+//CallInMain continues executing without waiting for it to finish.
+//When main returns, the program exits, even if goroutines are still running: a bare `go boring()`
+//would be killed mid-loop. So CallInMain shuts the coordinator down before it returns.
+
+// boringUntil stops when its context is cancelled, and a shutdown coordinator
+// (pkg/shutdown) cancels that context on Ctrl+C (SIGINT), SIGTERM, or when main decides to leave.
+// The coordinator then runs cleanup hooks and reports any goroutine that did not stop in time.
+// To notice a boring goroutine that is still running but stuck, see the heartbeat supervisor
+// in concurrency-heartbeat.go.
+func boringUntil(ctx context.Context, msg string) {
+	for i := 0; ; i++ {
+		fmt.Println(msg, i)
+		select {
+		case <-time.After(time.Second):
+		case <-ctx.Done():
+			fmt.Println(msg, "stopping:", ctx.Err())
+			return
+		}
+	}
+}
+
+// newDemoCoordinator returns a shutdown coordinator listening for SIGINT/SIGTERM.
+// Every long-running demo registers its goroutines and cleanup with it.
+func newDemoCoordinator() (*shutdown.Coordinator, func()) {
+	coord := shutdown.New(context.Background())
+	stop := coord.ListenForSignals(3 * time.Second)
+	return coord, stop
+}
+
+func CallInMainWithShutdown() {
+	coord, stop := newDemoCoordinator()
+	defer stop()
+
+	coord.Go("boring", func(ctx context.Context) { boringUntil(ctx, "boring!") })
+	coord.OnShutdown("say goodbye", time.Second, func(ctx context.Context) error {
+		fmt.Println("You're boring; I'm leaving.")
+		return nil
+	})
+
+	fmt.Println("I'm listening. (Ctrl+C to stop early)")
+	select {
+	case <-time.After(2 * time.Second):
+	case <-coord.Context().Done():
+	}
+	fmt.Println(coord.Shutdown(3 * time.Second))
 }
 
-//In the example, boring runs as a goroutine, printing messages.
-//The main function continues executing without waiting for boring to finish.
-//When main returns, the program exits, even if goroutines are still running.
 //--------------------------------------------------------------------------------------------------------------------------------
 /// B- Channels
 //In Go, a channel is a conduit through which goroutines communicate with each other.
@@ -153,6 +204,18 @@ func sendAndReceivingData() {
 	fmt.Println(msg) // Outputs: Hello, World!
 }
 
+// A goroutine that sends exactly one value, received once by the caller, is a "future".
+// Future[T] (concurrency-future.go) wraps that one-shot channel and adds an error,
+// many waiters and cancellation:
+func sendAndReceivingDataWithFuture() {
+	f := Go(func() (string, error) {
+		return "Hello, World!", nil
+	})
+
+	msg, err := f.Await(context.Background())
+	fmt.Println(msg, err) // Outputs: Hello, World! <nil>
+}
+
 //Important Note:
 //
 //Unbuffered channels block the sending goroutine until another goroutine receives from the channel, and vice versa.
@@ -226,6 +289,8 @@ func testSelect() {
 			fmt.Println(msg2)
 		}
 	}
+	//Closing (testCloseChannels) and select combine into reusable pipeline stages:
+	//see pkg/channels for OrDone, Tee, Bridge, Batch, Debounce, Throttle and Buffer.
 }
 
 //WaitGroups
@@ -315,4 +380,42 @@ func callHttp() {
 	fmt.Println("All URLs fetched.")
 }
 
+// The same fetch expressed with futures: one future per URL, combined with All.
+// Instead of printing from inside each goroutine, the statuses come back in URL order,
+// and a failing URL becomes the error of the whole fetch.
+func fetchStatus(url string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	return resp.Status, nil
+}
+
+func callHttpWithFutures() {
+	urls := []string{
+		"https://www.google.com",
+		"https://www.github.com",
+		"https://www.golang.org",
+	}
+
+	var futures []*Future[string]
+	for _, url := range urls {
+		url := url
+		futures = append(futures, Go(func() (string, error) { return fetchStatus(url) }))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	statuses, err := All(ctx, futures...).Await(ctx)
+	if err != nil {
+		fmt.Println("Error fetching URLs:", err)
+		return
+	}
+	for i, status := range statuses {
+		fmt.Printf("Fetched %s: %s\n", urls[i], status)
+	}
+	fmt.Println("All URLs fetched.")
+}
+
 //Source :https://www.youtube.com/watch?v=f6kdp27TYZs&t=1739s
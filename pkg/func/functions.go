@@ -8,11 +8,15 @@
 package functions
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"os"
 	"strconv"
 	"sync"
+
+	"Golan-Concepts/pkg/concurrency"
+	"Golan-Concepts/pkg/generics"
 )
 
 // =============================
@@ -113,6 +117,22 @@ func sum(nums ...int) int {
 // sum(1, 2, 3) // Returns 6
 // sum(10, 20)  // Returns 30
 
+// A variadic function receives its arguments as a slice, so a large slice can
+// be passed with `...` and split across goroutines.
+// This function is the parallel counterpart of sum, built on generics.ParallelReduce.
+
+func parallelSum(nums ...int) int {
+	total, _ := generics.ParallelReduce(context.Background(), nums, 0, add, generics.WithMinChunk(4096))
+	return total
+}
+
+// Example Usage:
+// parallelSum(1, 2, 3)  // Returns 6
+// parallelSum(nums...) // Same result as sum(nums...), computed on GOMAXPROCS goroutines
+
+// Adding ints is so cheap that parallelSum only pays off on large slices and with GOMAXPROCS > 1;
+// BenchmarkSum in functions_test.go compares the two on ten million ints.
+
 // =============================
 // 6. Anonymous Functions
 // =============================
@@ -261,24 +281,22 @@ func readFile(dstName, srcName string) {
 // Embedding mutexes within structs is a common practice to protect the struct's fields
 // from concurrent access. This approach encapsulates the synchronization mechanism,
 // promoting better code organization and safety.
+//
+// concurrency.Guarded goes one step further: the field and its lock are one
+// value, and the field can only be reached inside a function passed to With.
 
 type SafeCounter struct {
-	mu    sync.Mutex
-	value int
+	value concurrency.Guarded[int]
 }
 
 // Increment increases the counter by one.
 func (c *SafeCounter) Increment() {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	c.value++
+	c.value.With(func(v *int) { *v++ })
 }
 
 // Value returns the current value of the counter.
 func (c *SafeCounter) Value() int {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	return c.value
+	return c.value.Load()
 }
 
 // TestSafeCounter demonstrates the usage of SafeCounter with mutex protection.
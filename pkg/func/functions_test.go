@@ -0,0 +1,27 @@
+// functions_test.go
+//
+// Benchmarks for functions.go. Run them with:
+//
+//     go test -run '^$' -bench Sum -cpu 1,4 ./pkg/func
+
+package functions
+
+import "testing"
+
+// BenchmarkSum compares sum and parallelSum on ten million ints.
+func BenchmarkSum(b *testing.B) {
+	nums := make([]int, 10_000_000)
+	for i := range nums {
+		nums[i] = i
+	}
+	b.Run("sum", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			sum(nums...)
+		}
+	})
+	b.Run("parallelSum", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			parallelSum(nums...)
+		}
+	})
+}
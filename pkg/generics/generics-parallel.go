@@ -0,0 +1,329 @@
+package generics
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// ============================================================================
+// Generic Parallel Helpers
+// ============================================================================
+
+// Generics and goroutines combine well: the splitting, scheduling and
+// error handling of a parallel loop can be written once and reused for any
+// element type.
+//
+// The helpers in this file share the same behaviour:
+//
+// 1. Bounded concurrency:
+//    - At most `workers` goroutines run at once (GOMAXPROCS by default).
+//
+// 2. Order preservation:
+//    - Results are written by index, so output order matches input order.
+//
+// 3. Cancellation and short-circuiting:
+//    - The first error (or a cancelled context) stops all workers; the
+//      remaining elements are skipped and that error is returned.
+//
+// 4. Adaptive chunking:
+//    - Workers claim chunks from a shared cursor. Chunks start large (few
+//      synchronisations) and shrink as the work runs out (good balancing at
+//      the end), a strategy known as guided scheduling.
+
+// ParallelOption configures the parallel helpers.
+type ParallelOption func(*parallelConfig)
+
+type parallelConfig struct {
+	workers  int
+	minChunk int
+}
+
+// WithWorkers limits the number of goroutines. Values below 1 are ignored.
+func WithWorkers(n int) ParallelOption {
+	return func(c *parallelConfig) {
+		if n >= 1 {
+			c.workers = n
+		}
+	}
+}
+
+// WithMinChunk sets the smallest chunk a worker claims. Raise it when the
+// per-element work is tiny, so that claiming a chunk does not dominate.
+func WithMinChunk(n int) ParallelOption {
+	return func(c *parallelConfig) {
+		if n >= 1 {
+			c.minChunk = n
+		}
+	}
+}
+
+func newParallelConfig(opts []ParallelOption) parallelConfig {
+	cfg := parallelConfig{workers: runtime.GOMAXPROCS(0), minChunk: 1}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// chunker hands out [lo, hi) ranges of n elements. Each chunk is a share of
+// what is left, so chunks shrink as the work runs out.
+type chunker struct {
+	mu       sync.Mutex
+	next     int
+	n        int
+	workers  int
+	minChunk int
+}
+
+func (c *chunker) claim() (lo, hi int, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.next >= c.n {
+		return 0, 0, false
+	}
+	size := (c.n - c.next) / (2 * c.workers)
+	if size < c.minChunk {
+		size = c.minChunk
+	}
+	lo = c.next
+	hi = lo + size
+	if hi > c.n {
+		hi = c.n
+	}
+	c.next = hi
+	return lo, hi, true
+}
+
+// parallelChunks runs body over [0, n) in chunks on a bounded number of
+// goroutines. It stops at the first error or when ctx is cancelled.
+func parallelChunks(ctx context.Context, n int, cfg parallelConfig, body func(ctx context.Context, lo, hi int) error) error {
+	if n == 0 {
+		return ctx.Err()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	workers := cfg.workers
+	if workers > n {
+		workers = n
+	}
+	chunks := &chunker{n: n, workers: workers, minChunk: cfg.minChunk}
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if ctx.Err() != nil {
+					return
+				}
+				lo, hi, ok := chunks.claim()
+				if !ok {
+					return
+				}
+				if err := body(ctx, lo, hi); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// ParallelMap applies fn to every element of in and returns the results in
+// input order.
+func ParallelMap[T, U any](ctx context.Context, in []T, fn func(context.Context, T) (U, error), opts ...ParallelOption) ([]U, error) {
+	out := make([]U, len(in))
+	err := parallelChunks(ctx, len(in), newParallelConfig(opts), func(ctx context.Context, lo, hi int) error {
+		for i := lo; i < hi; i++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			u, err := fn(ctx, in[i])
+			if err != nil {
+				return err
+			}
+			out[i] = u
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ParallelFilter returns the elements of in for which keep returns true,
+// in input order.
+func ParallelFilter[T any](ctx context.Context, in []T, keep func(context.Context, T) (bool, error), opts ...ParallelOption) ([]T, error) {
+	flags, err := ParallelMap(ctx, in, keep, opts...)
+	if err != nil {
+		return nil, err
+	}
+	var out []T
+	for i, ok := range flags {
+		if ok {
+			out = append(out, in[i])
+		}
+	}
+	return out, nil
+}
+
+// ParallelReduce combines all elements of in with combine, starting from
+// identity. combine must be associative (like + or max); it does not need to
+// be commutative, because partial results are combined in input order.
+func ParallelReduce[T any](ctx context.Context, in []T, identity T, combine func(T, T) T, opts ...ParallelOption) (T, error) {
+	type partial struct {
+		lo    int
+		value T
+	}
+	var (
+		mu       sync.Mutex
+		partials []partial
+	)
+	err := parallelChunks(ctx, len(in), newParallelConfig(opts), func(ctx context.Context, lo, hi int) error {
+		acc := identity
+		for i := lo; i < hi; i++ {
+			acc = combine(acc, in[i])
+		}
+		mu.Lock()
+		partials = append(partials, partial{lo: lo, value: acc})
+		mu.Unlock()
+		return ctx.Err()
+	})
+	if err != nil {
+		return identity, err
+	}
+
+	sort.Slice(partials, func(i, j int) bool { return partials[i].lo < partials[j].lo })
+	result := identity
+	for _, p := range partials {
+		result = combine(result, p.value)
+	}
+	return result, nil
+}
+
+// ============================================================================
+// Parallel SortSlice
+// ============================================================================
+
+// ParallelSortSlice sorts a slice of any ordered type, like SortSlice, by
+// sorting one run per worker in parallel and then merging neighbouring runs
+// pairwise (also in parallel) until one run remains.
+func ParallelSortSlice[T Ordered](slice []T, opts ...ParallelOption) {
+	cfg := newParallelConfig(opts)
+	runs := cfg.workers
+	if runs > len(slice)/1024 {
+		// Below ~1k elements per run, goroutines cost more than they save.
+		runs = len(slice) / 1024
+	}
+	if runs < 2 {
+		SortSlice(slice)
+		return
+	}
+
+	bounds := make([]int, runs+1)
+	for i := range bounds {
+		bounds[i] = i * len(slice) / runs
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < runs; i++ {
+		wg.Add(1)
+		go func(run []T) {
+			defer wg.Done()
+			SortSlice(run)
+		}(slice[bounds[i]:bounds[i+1]])
+	}
+	wg.Wait()
+
+	src, dst := slice, make([]T, len(slice))
+	for len(bounds) > 2 {
+		var next []int
+		for i := 0; i+1 < len(bounds); i += 2 {
+			lo := bounds[i]
+			if i+2 >= len(bounds) {
+				// Odd run out: copy it through unchanged.
+				copy(dst[lo:], src[lo:bounds[i+1]])
+				next = append(next, lo)
+				continue
+			}
+			mid, hi := bounds[i+1], bounds[i+2]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				mergeRuns(dst[lo:hi], src[lo:mid], src[mid:hi])
+			}()
+			next = append(next, lo)
+		}
+		wg.Wait()
+		bounds = append(next, len(slice))
+		src, dst = dst, src
+	}
+	if &src[0] != &slice[0] {
+		copy(slice, src)
+	}
+}
+
+// mergeRuns merges the sorted slices a and b into out.
+func mergeRuns[T Ordered](out, a, b []T) {
+	i, j, k := 0, 0, 0
+	for i < len(a) && j < len(b) {
+		if b[j] < a[i] {
+			out[k] = b[j]
+			j++
+		} else {
+			out[k] = a[i]
+			i++
+		}
+		k++
+	}
+	k += copy(out[k:], a[i:])
+	copy(out[k:], b[j:])
+}
+
+// ============================================================================
+// Examples
+// ============================================================================
+
+func ExampleParallelMap() {
+	ctx := context.Background()
+	words := []string{"go", "generics", "are", "fun"}
+
+	lengths, _ := ParallelMap(ctx, words, func(_ context.Context, s string) (int, error) {
+		return len(s), nil
+	})
+	long, _ := ParallelFilter(ctx, words, func(_ context.Context, s string) (bool, error) {
+		return len(s) > 2, nil
+	})
+	total, _ := ParallelReduce(ctx, lengths, 0, func(a, b int) int { return a + b })
+
+	fmt.Println("Lengths:", lengths) // Output: Lengths: [2 8 3 3]
+	fmt.Println("Long:", long)       // Output: Long: [generics are fun]
+	fmt.Println("Total:", total)     // Output: Total: 16
+
+	_, err := ParallelMap(ctx, words, func(_ context.Context, s string) (int, error) {
+		if s == "are" {
+			return 0, fmt.Errorf("cannot handle %q", s)
+		}
+		return len(s), nil
+	})
+	fmt.Println("Error:", err) // Output: Error: cannot handle "are"
+}
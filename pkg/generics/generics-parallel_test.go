@@ -0,0 +1,36 @@
+// generics-parallel_test.go
+//
+// Benchmarks for generics-parallel.go. Run them with:
+//
+//     go test -run '^$' -bench SortSlice -cpu 1,4 ./pkg/generics
+
+package generics
+
+import "testing"
+
+// BenchmarkSortSlice compares SortSlice with ParallelSortSlice on a million
+// pseudo-random ints. The parallel version only wins with GOMAXPROCS > 1.
+func BenchmarkSortSlice(b *testing.B) {
+	input := make([]int, 1_000_000)
+	seed := uint32(1)
+	for i := range input {
+		seed = seed*1664525 + 1013904223
+		input[i] = int(seed >> 1)
+	}
+	work := make([]int, len(input))
+
+	for _, bench := range []struct {
+		name string
+		sort func([]int)
+	}{
+		{"SortSlice", func(s []int) { SortSlice(s) }},
+		{"ParallelSortSlice", func(s []int) { ParallelSortSlice(s) }},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				copy(work, input)
+				bench.sort(work)
+			}
+		})
+	}
+}
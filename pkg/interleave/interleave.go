@@ -0,0 +1,532 @@
+// interleave.go
+//
+// This package runs small concurrent programs under a cooperative scheduler
+// that decides which goroutine runs at every instrumented yield point. It
+// explores interleavings randomly or systematically and reports the first one
+// that produces a wrong result or a deadlock, in a form that can be replayed.
+
+package interleave
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// ==============================
+// Exploring Interleavings
+// ==============================
+//
+// workerWithoutMutex loses updates because counter++ is really two steps,
+// and another goroutine can run between them:
+//
+//     w1: read counter = 0
+//     w2: read counter = 0
+//     w1: write counter = 1
+//     w2: write counter = 1      <- w1's increment is lost
+//
+// Running the real program shows the bug only sometimes, and never the same
+// way twice. Here threads are goroutines that only run when the scheduler
+// wakes them, one at a time. Every shared access (Int.Load, Int.Store,
+// Mutex.Lock, ...) is a yield point: the thread stops, and the scheduler picks
+// which runnable thread goes next. The sequence of picks is the schedule, and
+// it fully determines the run.
+//
+// - Random mode picks with a seeded random source. A failing run is reported
+//   with its seed; the same seed gives the same run.
+// - Systematic mode enumerates schedules depth-first, so for a small program
+//   it either finds the bug or proves that no interleaving has it.
+//
+// A run fails when the program's check returns an error, a thread panics, or
+// every unfinished thread is blocked: a deadlock.
+
+// ErrDeadlock is wrapped by the error of a run in which every thread is blocked.
+var ErrDeadlock = errors.New("deadlock")
+
+// Program sets up shared state, starts threads with r.Go, and returns a check
+// that runs after all threads have finished. It is called once per run.
+type Program func(r *Run) (check func() error)
+
+// Schedule is the sequence of scheduler choices of one run: at each step, the
+// index of the chosen thread among the runnable ones.
+type Schedule []int
+
+func (s Schedule) String() string {
+	parts := make([]string, len(s))
+	for i, c := range s {
+		parts[i] = strconv.Itoa(c)
+	}
+	return strings.Join(parts, ".")
+}
+
+// ==============================
+// Threads and Instrumented State
+// ==============================
+
+// T is a thread of a Program. Its methods and the shared types below must
+// only be used from the thread's own function.
+type T struct {
+	name      string
+	run       *Run
+	fn        func(*T)
+	wake      chan struct{}
+	done      bool
+	aborted   bool
+	blockedOn *Mutex
+}
+
+// Name returns the name passed to Run.Go.
+func (t *T) Name() string {
+	return t.name
+}
+
+// Yield is a yield point: the scheduler may run another thread here.
+func (t *T) Yield() {
+	t.run.events <- struct{}{}
+	t.wait()
+}
+
+// Logf adds a line to the run's trace.
+func (t *T) Logf(format string, args ...any) {
+	t.run.trace = append(t.run.trace, t.name+": "+fmt.Sprintf(format, args...))
+}
+
+func (t *T) wait() {
+	select {
+	case <-t.wake:
+	case <-t.run.abort:
+		t.aborted = true
+		runtime.Goexit()
+	}
+}
+
+// Int is a shared integer. Every access is a yield point.
+type Int struct {
+	Name string
+	v    int
+}
+
+// Load reads the value.
+func (i *Int) Load(t *T) int {
+	t.Yield()
+	t.Logf("read %s = %d", i.Name, i.v)
+	return i.v
+}
+
+// Store writes the value.
+func (i *Int) Store(t *T, v int) {
+	t.Yield()
+	t.Logf("write %s = %d", i.Name, v)
+	i.v = v
+}
+
+// Value reads the value without yielding, for checks after the run.
+func (i *Int) Value() int {
+	return i.v
+}
+
+// Mutex is a lock known to the scheduler, so a thread waiting for it is
+// blocked rather than runnable.
+type Mutex struct {
+	Name  string
+	owner *T
+}
+
+// Lock acquires m, blocking the thread while another thread holds it.
+func (m *Mutex) Lock(t *T) {
+	t.Yield()
+	for m.owner != nil {
+		t.Logf("waits for %s (held by %s)", m.Name, m.owner.name)
+		t.blockedOn = m
+		t.Yield()
+	}
+	m.owner = t
+	t.Logf("lock %s", m.Name)
+}
+
+// Unlock releases m and makes its waiters runnable.
+func (m *Mutex) Unlock(t *T) {
+	t.Yield()
+	if m.owner != t {
+		panic(fmt.Sprintf("%s unlocks %s, which it does not hold", t.name, m.Name))
+	}
+	m.owner = nil
+	t.Logf("unlock %s", m.Name)
+	for _, other := range t.run.threads {
+		if other.blockedOn == m {
+			other.blockedOn = nil
+		}
+	}
+}
+
+// ==============================
+// Running One Schedule
+// ==============================
+
+// Run is one execution of a Program.
+type Run struct {
+	threads []*T
+	choose  func(n int) int
+	picks   []pick
+	trace   []string
+	events  chan struct{} // a thread stopped at a yield point or finished
+	abort   chan struct{} // closed to release the threads of a failed run
+	err     error
+}
+
+// pick is one scheduler decision: picked out of options runnable threads.
+type pick struct {
+	picked, options int
+}
+
+// Go starts a thread. It does not run until the scheduler picks it.
+func (r *Run) Go(name string, fn func(t *T)) {
+	t := &T{name: name, run: r, fn: fn, wake: make(chan struct{})}
+	r.threads = append(r.threads, t)
+	go func() {
+		defer func() {
+			if t.aborted {
+				return
+			}
+			if p := recover(); p != nil {
+				r.err = fmt.Errorf("%s panicked: %v", t.name, p)
+			}
+			t.done = true
+			r.events <- struct{}{}
+		}()
+		t.wait()
+		t.fn(t)
+	}()
+}
+
+// outcome is the result of one run.
+type outcome struct {
+	err      error
+	schedule Schedule
+	picks    []pick
+	trace    []string
+}
+
+func execute(p Program, choose func(n int) int, maxSteps int) outcome {
+	r := &Run{choose: choose, events: make(chan struct{}), abort: make(chan struct{})}
+	defer close(r.abort)
+
+	check := p(r)
+	for steps := 0; r.err == nil; steps++ {
+		var runnable []*T
+		unfinished := 0
+		for _, t := range r.threads {
+			if t.done {
+				continue
+			}
+			unfinished++
+			if t.blockedOn == nil {
+				runnable = append(runnable, t)
+			}
+		}
+		if unfinished == 0 {
+			if check != nil {
+				r.err = check()
+			}
+			break
+		}
+		if len(runnable) == 0 {
+			r.err = r.deadlock()
+			break
+		}
+		if steps == maxSteps {
+			r.err = fmt.Errorf("no progress after %d steps (livelock?)", maxSteps)
+			break
+		}
+
+		i := 0
+		if len(runnable) > 1 {
+			i = r.choose(len(runnable))
+			r.picks = append(r.picks, pick{i, len(runnable)})
+		}
+		runnable[i].wake <- struct{}{}
+		<-r.events
+	}
+
+	o := outcome{err: r.err, picks: r.picks, trace: r.trace}
+	for _, p := range r.picks {
+		o.schedule = append(o.schedule, p.picked)
+	}
+	return o
+}
+
+func (r *Run) deadlock() error {
+	var waits []string
+	for _, t := range r.threads {
+		if !t.done {
+			waits = append(waits, fmt.Sprintf("%s waits for %s (held by %s)", t.name, t.blockedOn.Name, t.blockedOn.owner.name))
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrDeadlock, strings.Join(waits, ", "))
+}
+
+// ==============================
+// Exploration
+// ==============================
+
+// Mode selects how schedules are chosen.
+type Mode int
+
+const (
+	Random Mode = iota
+	Systematic
+)
+
+// Options configures Explore.
+type Options struct {
+	Mode Mode
+	// Runs is the maximum number of runs. Defaults to 1000.
+	Runs int
+	// Seed is the seed of the first random run; run i uses Seed+i. Defaults to 1.
+	Seed int64
+	// MaxSteps bounds one run, to catch livelocks. Defaults to 10000.
+	MaxSteps int
+}
+
+// Failure is a failing run and what is needed to repeat it.
+type Failure struct {
+	Err      error
+	Seed     int64    // random mode: pass as Options.Seed to repeat the run
+	Schedule Schedule // pass to Replay to repeat the run in any mode
+	Trace    []string
+}
+
+func (f *Failure) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "failure: %v\n", f.Err)
+	if f.Seed != 0 {
+		fmt.Fprintf(&b, "seed: %d, ", f.Seed)
+	}
+	fmt.Fprintf(&b, "schedule: %s\n", f.Schedule)
+	for _, line := range f.Trace {
+		fmt.Fprintf(&b, "  %s\n", line)
+	}
+	return b.String()
+}
+
+// Result summarizes an exploration.
+type Result struct {
+	Runs      int
+	Exhausted bool     // systematic mode tried every schedule
+	Failure   *Failure // nil if no run failed
+}
+
+func (r Result) String() string {
+	switch {
+	case r.Failure != nil:
+		return fmt.Sprintf("failed after %d run(s)\n%s", r.Runs, r.Failure)
+	case r.Exhausted:
+		return fmt.Sprintf("all %d interleavings passed", r.Runs)
+	default:
+		return fmt.Sprintf("%d runs passed (not exhaustive)", r.Runs)
+	}
+}
+
+// Explore runs p under different schedules until one fails, the run budget
+// is spent, or (in systematic mode) every schedule has been tried.
+func Explore(p Program, opts Options) Result {
+	if opts.Runs <= 0 {
+		opts.Runs = 1000
+	}
+	if opts.Seed == 0 {
+		opts.Seed = 1
+	}
+	if opts.MaxSteps <= 0 {
+		opts.MaxSteps = 10000
+	}
+
+	var prefix Schedule
+	for run := 0; run < opts.Runs; run++ {
+		var o outcome
+		seed := opts.Seed + int64(run)
+		if opts.Mode == Random {
+			rng := rand.New(rand.NewSource(seed))
+			o = execute(p, rng.Intn, opts.MaxSteps)
+		} else {
+			o = execute(p, follow(prefix), opts.MaxSteps)
+		}
+		if o.err != nil {
+			f := &Failure{Err: o.err, Schedule: o.schedule, Trace: o.trace}
+			if opts.Mode == Random {
+				f.Seed = seed
+			}
+			return Result{Runs: run + 1, Failure: f}
+		}
+		if opts.Mode == Systematic {
+			next, ok := nextSchedule(o.picks)
+			if !ok {
+				return Result{Runs: run + 1, Exhausted: true}
+			}
+			prefix = next
+		}
+	}
+	return Result{Runs: opts.Runs}
+}
+
+// Replay runs p once with the given schedule. It returns nil if the run passes.
+func Replay(p Program, s Schedule) *Failure {
+	o := execute(p, follow(s), 10000)
+	if o.err == nil {
+		return nil
+	}
+	return &Failure{Err: o.err, Schedule: o.schedule, Trace: o.trace}
+}
+
+// follow returns a chooser that replays s and then always picks the first
+// runnable thread.
+func follow(s Schedule) func(n int) int {
+	pos := 0
+	return func(n int) int {
+		if pos >= len(s) {
+			return 0
+		}
+		c := s[pos]
+		pos++
+		if c >= n {
+			c = n - 1
+		}
+		return c
+	}
+}
+
+// nextSchedule returns the depth-first successor of a run's picks: the last
+// pick that still has an untried alternative is advanced, and everything
+// after it is left to the default.
+func nextSchedule(picks []pick) (Schedule, bool) {
+	for i := len(picks) - 1; i >= 0; i-- {
+		if picks[i].picked+1 < picks[i].options {
+			next := make(Schedule, i+1)
+			for j := range next {
+				next[j] = picks[j].picked
+			}
+			next[i]++
+			return next, true
+		}
+	}
+	return nil, false
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// racyCounter is workerWithoutMutex with two workers doing two increments
+// each, written against the instrumented Int.
+func racyCounter(r *Run) func() error {
+	counter := &Int{Name: "counter"}
+	for _, name := range []string{"w1", "w2"} {
+		r.Go(name, func(t *T) {
+			for i := 0; i < 2; i++ {
+				v := counter.Load(t)
+				counter.Store(t, v+1)
+			}
+		})
+	}
+	return func() error {
+		if counter.Value() != 4 {
+			return fmt.Errorf("counter = %d, want 4", counter.Value())
+		}
+		return nil
+	}
+}
+
+// mutexCounter is workerWithMutex: the same program with the increment
+// inside a lock.
+func mutexCounter(r *Run) func() error {
+	counter := &Int{Name: "counter"}
+	mu := &Mutex{Name: "mu"}
+	for _, name := range []string{"w1", "w2"} {
+		r.Go(name, func(t *T) {
+			for i := 0; i < 2; i++ {
+				mu.Lock(t)
+				v := counter.Load(t)
+				counter.Store(t, v+1)
+				mu.Unlock(t)
+			}
+		})
+	}
+	return func() error {
+		if counter.Value() != 4 {
+			return fmt.Errorf("counter = %d, want 4", counter.Value())
+		}
+		return nil
+	}
+}
+
+// lockOrder takes two locks in opposite orders, like deadlockExample.
+func lockOrder(r *Run) func() error {
+	a, b := &Mutex{Name: "A"}, &Mutex{Name: "B"}
+	r.Go("t1", func(t *T) {
+		a.Lock(t)
+		b.Lock(t)
+		b.Unlock(t)
+		a.Unlock(t)
+	})
+	r.Go("t2", func(t *T) {
+		b.Lock(t)
+		a.Lock(t)
+		a.Unlock(t)
+		b.Unlock(t)
+	})
+	return nil
+}
+
+// TestRacyCounter finds the lost update randomly and systematically, then
+// replays the failing schedule.
+func TestRacyCounter() {
+	random := Explore(racyCounter, Options{Mode: Random})
+	fmt.Println("random:", random)
+
+	// The same seed gives the same run.
+	if random.Failure != nil {
+		again := Explore(racyCounter, Options{Mode: Random, Seed: random.Failure.Seed, Runs: 1})
+		fmt.Println("same seed, same schedule:", again.Failure != nil &&
+			again.Failure.Schedule.String() == random.Failure.Schedule.String())
+	}
+
+	systematic := Explore(racyCounter, Options{Mode: Systematic})
+	fmt.Println("systematic:", systematic)
+	if systematic.Failure == nil {
+		return
+	}
+	if f := Replay(racyCounter, systematic.Failure.Schedule); f != nil {
+		fmt.Println("replay:", f.Err)
+	} else {
+		fmt.Println("replay: passed")
+	}
+	// systematic: failed after 3 run(s)
+	// failure: counter = 3, want 4
+	// schedule: 0.0.0.0.1.1.0
+	//   w1: read counter = 0
+	//   w1: write counter = 1
+	//   w1: read counter = 1
+	//   w2: read counter = 1
+	//   w1: write counter = 2
+	//   w2: write counter = 2      <- w1's second increment is lost
+	//   w2: read counter = 2
+	//   w2: write counter = 3
+	// replay: counter = 3, want 4
+}
+
+// TestMutexCounter proves the locked version correct for every interleaving.
+func TestMutexCounter() {
+	fmt.Println(Explore(mutexCounter, Options{Mode: Systematic, Runs: 100000}))
+	// all 1316 interleavings passed
+}
+
+// TestLockOrderDeadlock finds the schedule in which both threads hold one
+// lock and wait for the other.
+func TestLockOrderDeadlock() {
+	fmt.Println(Explore(lockOrder, Options{Mode: Systematic}))
+	// failed after 17 run(s)
+	// failure: deadlock: t1 waits for B (held by t2), t2 waits for A (held by t1)
+	// ...
+}
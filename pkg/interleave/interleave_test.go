@@ -0,0 +1,54 @@
+// interleave_test.go
+//
+// Tests for the interleaving explorer, on the example programs of
+// interleave.go.
+
+package interleave
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSystematicFindsLostUpdate(t *testing.T) {
+	res := Explore(racyCounter, Options{Mode: Systematic})
+	if res.Failure == nil {
+		t.Fatalf("no failure found: %v", res)
+	}
+	if got := res.Failure.Err.Error(); got != "counter = 3, want 4" {
+		t.Fatalf("failure = %q, want the lost update", got)
+	}
+
+	f := Replay(racyCounter, res.Failure.Schedule)
+	if f == nil {
+		t.Fatalf("replay of %v passed", res.Failure.Schedule)
+	}
+	if f.Err.Error() != res.Failure.Err.Error() || f.Schedule.String() != res.Failure.Schedule.String() {
+		t.Fatalf("replay = %v on %v, want %v on %v", f.Err, f.Schedule, res.Failure.Err, res.Failure.Schedule)
+	}
+}
+
+func TestRandomSeedRepeatsRun(t *testing.T) {
+	res := Explore(racyCounter, Options{Mode: Random, Seed: 1})
+	if res.Failure == nil {
+		t.Fatalf("random mode found no failure: %v", res)
+	}
+	again := Explore(racyCounter, Options{Mode: Random, Seed: res.Failure.Seed, Runs: 1})
+	if again.Failure == nil || again.Failure.Schedule.String() != res.Failure.Schedule.String() {
+		t.Fatalf("seed %d did not repeat schedule %v", res.Failure.Seed, res.Failure.Schedule)
+	}
+}
+
+func TestMutexCounterPassesEveryInterleaving(t *testing.T) {
+	res := Explore(mutexCounter, Options{Mode: Systematic, Runs: 100000})
+	if res.Failure != nil || !res.Exhausted {
+		t.Fatalf("got %v, want every interleaving to pass", res)
+	}
+}
+
+func TestLockOrderDeadlockFound(t *testing.T) {
+	res := Explore(lockOrder, Options{Mode: Systematic})
+	if res.Failure == nil || !errors.Is(res.Failure.Err, ErrDeadlock) {
+		t.Fatalf("got %v, want a deadlock", res)
+	}
+}
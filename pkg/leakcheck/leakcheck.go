@@ -0,0 +1,272 @@
+// leakcheck.go
+//
+// This package finds goroutine leaks: goroutines started by a function that
+// are still running after the function returns. It works from _test.go files
+// (Verify) and from demo code (Run).
+
+package leakcheck
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ==============================
+// Goroutine Leaks
+// ==============================
+//
+// A goroutine leaks when nothing will ever let it finish. The usual cause is a
+// goroutine blocked on a channel operation whose other side has gone away:
+//
+//     c := generatorWithBoring(coord, "boring!")
+//     fmt.Println(<-c)  // main reads once and moves on without shutting coord down...
+//                       // ...the generator blocks on its next send forever
+//
+// Leaked goroutines are never garbage collected, and neither is anything they
+// reference. The checker works like this:
+//
+// 1. Snapshot all goroutines before the code under test runs.
+// 2. Run it.
+// 3. Snapshot again and keep the goroutines that are new. Goroutines that are
+//    merely slow to exit get a settle period: the check is repeated until
+//    either no new goroutines remain or the period runs out.
+// 4. Drop runtime and system goroutines, and report the rest with their stacks.
+
+// Goroutine is one goroutine from a stack dump.
+type Goroutine struct {
+	ID    int64
+	State string // e.g. "chan send", "select", "sleep"
+	Entry string // the function the goroutine was started with
+	Stack string
+}
+
+func (g Goroutine) String() string {
+	return fmt.Sprintf("goroutine %d [%s]:\n%s", g.ID, g.State, g.Stack)
+}
+
+// Options configures a check.
+type Options struct {
+	// Settle is how long to wait for new goroutines to exit. Defaults to 500ms.
+	Settle time.Duration
+	// Ignore lists entry functions (or prefixes of them) that are allowed
+	// to outlive the check, e.g. "net/http.(*persistConn)".
+	Ignore []string
+}
+
+// systemEntries are started by the runtime or the standard library and are
+// not leaks of the code under test.
+var systemEntries = []string{
+	"runtime.",
+	"os/signal.",
+	"testing.",
+	"internal/poll.",
+	"net/http.(*persistConn)",
+}
+
+// ==============================
+// Checking
+// ==============================
+
+// Report is the result of a check.
+type Report struct {
+	Leaked []Goroutine
+}
+
+// Err returns nil when nothing leaked, and otherwise an error listing the
+// leaked goroutines with their stacks.
+func (r Report) Err() error {
+	if len(r.Leaked) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", r.String())
+}
+
+func (r Report) String() string {
+	if len(r.Leaked) == 0 {
+		return "no leaked goroutines"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d leaked goroutine(s):\n", len(r.Leaked))
+	for _, g := range r.Leaked {
+		b.WriteString("\n")
+		b.WriteString(g.String())
+	}
+	return b.String()
+}
+
+// Check runs fn and reports goroutines it left behind.
+func Check(fn func(), opts Options) Report {
+	before := Snapshot()
+	fn()
+	return Since(before, opts)
+}
+
+// Since waits up to the settle period for goroutines that are not in before
+// to exit, and reports the ones that did not.
+func Since(before map[int64]Goroutine, opts Options) Report {
+	settle := opts.Settle
+	if settle <= 0 {
+		settle = 500 * time.Millisecond
+	}
+	deadline := time.Now().Add(settle)
+	self := currentID()
+
+	for {
+		var leaked []Goroutine
+		for id, g := range Snapshot() {
+			if _, existed := before[id]; existed || id == self || ignored(g, opts.Ignore) {
+				continue
+			}
+			leaked = append(leaked, g)
+		}
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			sort.Slice(leaked, func(i, j int) bool { return leaked[i].ID < leaked[j].ID })
+			return Report{Leaked: leaked}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TB is the subset of testing.TB used by Verify, so this package does not
+// need to import "testing".
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Verify snapshots the current goroutines and returns a function that fails
+// t if new goroutines are still running when it is called. Use it with defer
+// at the top of a test:
+//
+//	func TestGenerator(t *testing.T) {
+//		defer leakcheck.Verify(t, leakcheck.Options{})()
+//		...
+//	}
+func Verify(t TB, opts Options) func() {
+	before := Snapshot()
+	return func() {
+		t.Helper()
+		if err := Since(before, opts).Err(); err != nil {
+			t.Errorf("%v", err)
+		}
+	}
+}
+
+// Run is the demo-runner version of Check: it runs fn and prints the result.
+func Run(name string, fn func(), opts Options) Report {
+	report := Check(fn, opts)
+	fmt.Printf("leakcheck %s: %s\n", name, report)
+	return report
+}
+
+func ignored(g Goroutine, extra []string) bool {
+	for _, prefix := range systemEntries {
+		if strings.HasPrefix(g.Entry, prefix) {
+			return true
+		}
+	}
+	for _, prefix := range extra {
+		if strings.HasPrefix(g.Entry, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ==============================
+// Parsing Stack Dumps
+// ==============================
+
+// Snapshot returns every goroutine currently running, keyed by ID.
+func Snapshot() map[int64]Goroutine {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	goroutines := make(map[int64]Goroutine)
+	for _, block := range bytes.Split(buf, []byte("\n\n")) {
+		if g, ok := parseGoroutine(string(block)); ok {
+			goroutines[g.ID] = g
+		}
+	}
+	return goroutines
+}
+
+// parseGoroutine parses one block of a stack dump:
+//
+//	goroutine 18 [chan send]:
+//	main.generator.func1()
+//		/src/main.go:12 +0x4e
+//	created by main.generator in goroutine 1
+//		/src/main.go:10 +0x7a
+func parseGoroutine(block string) (Goroutine, bool) {
+	lines := strings.Split(strings.TrimSpace(block), "\n")
+	header := lines[0]
+	if !strings.HasPrefix(header, "goroutine ") {
+		return Goroutine{}, false
+	}
+	fields := strings.SplitN(strings.TrimPrefix(header, "goroutine "), " ", 2)
+	id, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil || len(fields) < 2 {
+		return Goroutine{}, false
+	}
+	state := strings.TrimSuffix(strings.TrimPrefix(fields[1], "["), "]:")
+	if i := strings.Index(state, ","); i >= 0 {
+		state = state[:i] // drop ", 2 minutes" and similar
+	}
+
+	g := Goroutine{ID: id, State: state, Stack: strings.Join(lines[1:], "\n") + "\n"}
+	// Function lines alternate with indented file:line lines. The entry
+	// function is the last function line before "created by". Very deep
+	// stacks are cut short with a marker line, which is not a function:
+	// "...N frames elided..." replaces the middle of the stack (the entry
+	// frame is still printed after it), while older runtimes print
+	// "...additional frames elided..." and drop the rest, in which case the
+	// deepest printed frame is the best guess at the entry.
+	//
+	// A goroutine that has not started running yet shows only runtime.goexit.
+	// Its Entry is left empty rather than set to a runtime function, so it is
+	// not mistaken for a system goroutine before it gets to run.
+	for _, line := range lines[1:] {
+		switch {
+		case strings.HasPrefix(line, "created by "):
+			return g, true
+		case strings.HasPrefix(line, "\t"), isElided(line), funcName(line) == "runtime.goexit":
+			continue
+		}
+		g.Entry = funcName(line)
+	}
+	return g, true
+}
+
+// isElided reports whether line is the runtime's marker for frames left out
+// of a deep stack.
+func isElided(line string) bool {
+	return strings.HasPrefix(line, "...") && strings.HasSuffix(line, " elided...")
+}
+
+// funcName strips the argument list from a stack line like "main.f(0x1, 0x2)".
+func funcName(line string) string {
+	if i := strings.LastIndex(line, "("); i > 0 && strings.HasSuffix(line, ")") {
+		return line[:i]
+	}
+	return line
+}
+
+func currentID() int64 {
+	var buf [64]byte
+	n := runtime.Stack(buf[:], false)
+	g, _ := parseGoroutine(string(buf[:n]) + "\n")
+	return g.ID
+}
@@ -0,0 +1,136 @@
+// leakcheck_test.go
+//
+// Tests for the leak checker, written the way it is meant to be used from
+// other packages' tests.
+
+package leakcheck
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeTB records Verify's failures instead of failing the real test.
+type fakeTB struct {
+	errors []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...any) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func TestVerifyPassesWhenGoroutinesExit(t *testing.T) {
+	defer Verify(t, Options{})()
+
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(10 * time.Millisecond) // still running when Verify starts checking
+		close(done)
+	}()
+}
+
+func TestVerifyReportsLeak(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	tb := &fakeTB{}
+	check := Verify(tb, Options{Settle: 50 * time.Millisecond})
+	go leakyWorker(block)
+	check()
+
+	if len(tb.errors) != 1 {
+		t.Fatalf("Verify reported %d errors, want 1", len(tb.errors))
+	}
+	if !strings.Contains(tb.errors[0], "leakyWorker") {
+		t.Fatalf("report does not name the leaked goroutine:\n%s", tb.errors[0])
+	}
+}
+
+func leakyWorker(block <-chan struct{}) {
+	<-block
+}
+
+func TestParseGoroutineEntry(t *testing.T) {
+	for _, tc := range []struct {
+		name, block, entry string
+	}{
+		{
+			name: "complete",
+			block: "goroutine 18 [chan send]:\n" +
+				"main.generator.func1()\n\t/src/main.go:12 +0x4e\n" +
+				"created by main.generator in goroutine 1\n\t/src/main.go:10 +0x7a\n",
+			entry: "main.generator.func1",
+		},
+		{
+			name: "middle elided",
+			block: "goroutine 7 [select, 2 minutes]:\n" +
+				"main.deep(0x64)\n\t/src/main.go:30 +0x10\n" +
+				"...120 frames elided...\n" +
+				"main.worker()\n\t/src/main.go:40 +0x20\n" +
+				"created by main.start in goroutine 1\n\t/src/main.go:50 +0x30\n",
+			entry: "main.worker",
+		},
+		{
+			name: "tail elided",
+			block: "goroutine 9 [sleep]:\n" +
+				"main.deep(0x1)\n\t/src/main.go:30 +0x10\n" +
+				"...additional frames elided...\n" +
+				"created by main.start in goroutine 1\n\t/src/main.go:50 +0x30\n",
+			entry: "main.deep",
+		},
+		{
+			name: "not started",
+			block: "goroutine 11 [runnable]:\n" +
+				"runtime.goexit({})\n\t/go/src/runtime/asm_amd64.s:1700 +0x1\n" +
+				"created by main.start in goroutine 1\n\t/src/main.go:50 +0x30\n",
+			entry: "",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			g, ok := parseGoroutine(tc.block)
+			if !ok {
+				t.Fatal("parseGoroutine failed")
+			}
+			if g.Entry != tc.entry {
+				t.Fatalf("Entry = %q, want %q", g.Entry, tc.entry)
+			}
+		})
+	}
+}
+
+func TestSnapshotFindsDeepGoroutine(t *testing.T) {
+	defer Verify(t, Options{})()
+
+	block := make(chan struct{})
+	started := make(chan struct{})
+	go deepWorker(200, started, block)
+	<-started
+
+	var found bool
+	for _, g := range Snapshot() {
+		if strings.Contains(g.Stack, "deepWorker") {
+			found = true
+			if g.Entry != "Golan-Concepts/pkg/leakcheck.deepWorker" {
+				t.Errorf("Entry = %q, want deepWorker", g.Entry)
+			}
+		}
+	}
+	if !found {
+		t.Error("deep goroutine not in snapshot")
+	}
+	close(block)
+}
+
+// deepWorker recurses depth times, so its stack is too deep to print in full.
+func deepWorker(depth int, started chan<- struct{}, block <-chan struct{}) {
+	if depth == 0 {
+		close(started)
+		<-block
+		return
+	}
+	deepWorker(depth-1, started, block)
+}
@@ -0,0 +1,562 @@
+// philosophers.go
+//
+// This package simulates the dining philosophers with pluggable fork
+// strategies and reports meals per philosopher, starvation, and whether a
+// watchdog had to stop a dinner that made no progress.
+
+package philosophers
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ==============================
+// Dining Philosophers
+// ==============================
+//
+// N philosophers sit around a table with one fork between each pair. A
+// philosopher thinks, gets hungry, picks up the forks on both sides, eats,
+// and puts them down. Philosopher i uses fork i (left) and fork i+1 (right):
+//
+//              P0
+//          F0      F1
+//        P4          P1
+//          F4      F2
+//           P3  F3  P2
+//
+// If every philosopher picks up the left fork at the same moment, everyone
+// waits for a right fork that will never come: a deadlock, the AB/BA lock
+// order cycle from concurrency-lockorder.go, only with N locks. The strategies break it in
+// different ways:
+//
+// - Naive:       left, then right. Deadlocks.
+// - Ordered:     always pick up the lower-numbered fork first, so the last
+//                philosopher reaches right first and the cycle cannot close.
+// - Waiter:      a waiter lets at most N-1 philosophers reach for forks, so at
+//                least one of them can always get both.
+// - ChandyMisra: forks are dirty after use and handed to a neighbour who asks,
+//                which prevents deadlock and starvation without a central party.
+// - TryLock:     pick up left, try right; on failure put left down and back
+//                off for a random time. No deadlock, but it can livelock.
+//
+// Forks are channels holding one token, so a hungry philosopher can give up
+// when the run ends, which a sync.Mutex cannot do.
+
+// Config describes one dinner.
+type Config struct {
+	Philosophers int           // defaults to 5
+	Duration     time.Duration // defaults to 2s
+	Strategy     Strategy
+	Think, Eat   time.Duration // upper bounds of random think and eat times; default 10ms
+	// Reach is the pause between picking up the first and second fork. A
+	// non-zero Reach makes the naive deadlock happen almost immediately.
+	Reach time.Duration
+	// Watchdog stops the dinner when nobody has eaten for this long while
+	// everyone is hungry. Defaults to 500ms.
+	Watchdog time.Duration
+	// Starving marks a philosopher who waited longer than this for one meal.
+	// Defaults to Duration / 4.
+	Starving time.Duration
+	Seed     int64
+}
+
+// Strategy is a way of picking up forks.
+type Strategy interface {
+	Name() string
+	newTable(n int, reach time.Duration) table
+}
+
+// table is one dinner's forks, set up by a Strategy.
+type table interface {
+	// pickUp returns once philosopher id holds both forks, or ctx is done.
+	pickUp(ctx context.Context, id int, rng *rand.Rand) error
+	putDown(id int)
+}
+
+// The strategies, ready to use in Config.
+var (
+	Naive       Strategy = naive{}
+	Ordered     Strategy = ordered{}
+	Waiter      Strategy = waiter{}
+	ChandyMisra Strategy = chandyMisra{}
+	TryLock     Strategy = tryLock{}
+
+	Strategies = []Strategy{Naive, Ordered, Waiter, ChandyMisra, TryLock}
+)
+
+// ==============================
+// Forks
+// ==============================
+
+// forks holds one channel per fork; a fork is on the table when its channel
+// holds a token.
+type forks []chan struct{}
+
+func newForks(n int) forks {
+	f := make(forks, n)
+	for i := range f {
+		f[i] = make(chan struct{}, 1)
+		f[i] <- struct{}{}
+	}
+	return f
+}
+
+func (f forks) left(id int) int  { return id }
+func (f forks) right(id int) int { return (id + 1) % len(f) }
+
+func (f forks) take(ctx context.Context, fork int) error {
+	select {
+	case <-f[fork]:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (f forks) tryTake(fork int) bool {
+	select {
+	case <-f[fork]:
+		return true
+	default:
+		return false
+	}
+}
+
+func (f forks) put(fork int) {
+	f[fork] <- struct{}{}
+}
+
+// takeBoth takes first, pauses for reach, then takes second. On
+// cancellation it puts back what it took.
+func (f forks) takeBoth(ctx context.Context, first, second int, reach time.Duration) error {
+	if err := f.take(ctx, first); err != nil {
+		return err
+	}
+	time.Sleep(reach)
+	if err := f.take(ctx, second); err != nil {
+		f.put(first)
+		return err
+	}
+	return nil
+}
+
+// ==============================
+// Strategies
+// ==============================
+
+type naive struct{}
+
+func (naive) Name() string { return "naive" }
+func (naive) newTable(n int, reach time.Duration) table {
+	return &naiveTable{forks: newForks(n), reach: reach}
+}
+
+type naiveTable struct {
+	forks forks
+	reach time.Duration
+}
+
+func (t *naiveTable) pickUp(ctx context.Context, id int, _ *rand.Rand) error {
+	return t.forks.takeBoth(ctx, t.forks.left(id), t.forks.right(id), t.reach)
+}
+
+func (t *naiveTable) putDown(id int) {
+	t.forks.put(t.forks.left(id))
+	t.forks.put(t.forks.right(id))
+}
+
+type ordered struct{}
+
+func (ordered) Name() string { return "ordered" }
+func (ordered) newTable(n int, reach time.Duration) table {
+	return &orderedTable{naiveTable{forks: newForks(n), reach: reach}}
+}
+
+type orderedTable struct {
+	naiveTable
+}
+
+func (t *orderedTable) pickUp(ctx context.Context, id int, _ *rand.Rand) error {
+	first, second := t.forks.left(id), t.forks.right(id)
+	if second < first {
+		first, second = second, first
+	}
+	return t.forks.takeBoth(ctx, first, second, t.reach)
+}
+
+type waiter struct{}
+
+func (waiter) Name() string { return "waiter" }
+func (waiter) newTable(n int, reach time.Duration) table {
+	return &waiterTable{
+		naiveTable: naiveTable{forks: newForks(n), reach: reach},
+		seats:      make(chan struct{}, n-1),
+	}
+}
+
+// waiterTable is the naive table behind a semaphore of n-1 seats.
+type waiterTable struct {
+	naiveTable
+	seats chan struct{}
+}
+
+func (t *waiterTable) pickUp(ctx context.Context, id int, rng *rand.Rand) error {
+	select {
+	case t.seats <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := t.naiveTable.pickUp(ctx, id, rng); err != nil {
+		<-t.seats
+		return err
+	}
+	return nil
+}
+
+func (t *waiterTable) putDown(id int) {
+	t.naiveTable.putDown(id)
+	<-t.seats
+}
+
+type tryLock struct{}
+
+func (tryLock) Name() string { return "trylock" }
+func (tryLock) newTable(n int, reach time.Duration) table {
+	return &tryLockTable{naiveTable{forks: newForks(n), reach: reach}}
+}
+
+type tryLockTable struct {
+	naiveTable
+}
+
+func (t *tryLockTable) pickUp(ctx context.Context, id int, rng *rand.Rand) error {
+	backoff := time.Millisecond
+	for {
+		left, right := t.forks.left(id), t.forks.right(id)
+		if err := t.forks.take(ctx, left); err != nil {
+			return err
+		}
+		time.Sleep(t.reach)
+		if t.forks.tryTake(right) {
+			return nil
+		}
+		t.forks.put(left)
+		// Random backoff, so neighbours do not retry in lockstep forever.
+		select {
+		case <-time.After(time.Duration(rng.Int63n(int64(backoff)) + 1)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if backoff < 50*time.Millisecond {
+			backoff *= 2
+		}
+	}
+}
+
+// ==============================
+// Chandy-Misra
+// ==============================
+//
+// Every fork is always held by one of its two neighbours, and is either clean
+// or dirty:
+//
+// 1. Initially each fork is dirty and held by the neighbour with the lower id.
+// 2. A hungry philosopher requests the forks it does not hold.
+// 3. A holder that is not eating gives up a requested fork if it is dirty,
+//    cleaning it first. A clean fork is kept until its holder has eaten.
+// 4. Eating makes both forks dirty.
+//
+// A philosopher who just ate must give its forks to hungry neighbours before
+// eating again, so nobody starves. In the original, requests and forks travel
+// as messages between philosophers; here the fork states live under one
+// mutex to keep the rules in one place.
+
+type chandyMisra struct{}
+
+func (chandyMisra) Name() string { return "chandy-misra" }
+func (chandyMisra) newTable(n int, reach time.Duration) table {
+	t := &cmTable{n: n, forks: make([]cmFork, n), eating: make([]bool, n)}
+	t.cond = sync.NewCond(&t.mu)
+	for i := range t.forks {
+		a, b := cmNeighbours(i, n)
+		holder := a
+		if b < a {
+			holder = b
+		}
+		t.forks[i] = cmFork{holder: holder, dirty: true}
+	}
+	return t
+}
+
+type cmFork struct {
+	holder    int
+	dirty     bool
+	requested bool // the other neighbour wants it
+}
+
+type cmTable struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	n      int
+	forks  []cmFork
+	eating []bool
+}
+
+// cmNeighbours returns the two philosophers sharing fork i: fork i is the
+// left fork of philosopher i and the right fork of philosopher i-1.
+func cmNeighbours(i, n int) (int, int) {
+	return i, (i + n - 1) % n
+}
+
+// mine returns the two forks of philosopher id.
+func (t *cmTable) mine(id int) [2]int {
+	return [2]int{id, (id + 1) % t.n}
+}
+
+// settle hands every requested dirty fork whose holder is not eating to the
+// neighbour that asked for it. The caller must hold t.mu.
+func (t *cmTable) settle() {
+	for i := range t.forks {
+		f := &t.forks[i]
+		if f.requested && f.dirty && !t.eating[f.holder] {
+			a, b := cmNeighbours(i, t.n)
+			if f.holder == a {
+				f.holder = b
+			} else {
+				f.holder = a
+			}
+			f.dirty, f.requested = false, false
+		}
+	}
+	t.cond.Broadcast()
+}
+
+func (t *cmTable) pickUp(ctx context.Context, id int, _ *rand.Rand) error {
+	// sync.Cond cannot wait on a context: wake everyone when ctx is done.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			t.mu.Lock()
+			t.cond.Broadcast()
+			t.mu.Unlock()
+		case <-stop:
+		}
+	}()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		for _, fork := range t.mine(id) {
+			if t.forks[fork].holder != id {
+				t.forks[fork].requested = true
+			}
+		}
+		// Settling may hand us the fork we just asked for, so check after it.
+		t.settle()
+		if t.holdsBoth(id) {
+			t.eating[id] = true
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		t.cond.Wait()
+	}
+}
+
+func (t *cmTable) holdsBoth(id int) bool {
+	forks := t.mine(id)
+	return t.forks[forks[0]].holder == id && t.forks[forks[1]].holder == id
+}
+
+func (t *cmTable) putDown(id int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.eating[id] = false
+	for _, fork := range t.mine(id) {
+		t.forks[fork].dirty = true
+	}
+	t.settle()
+}
+
+// ==============================
+// Dinner
+// ==============================
+
+// Report is the outcome of one dinner.
+type Report struct {
+	Strategy    string
+	Meals       []int
+	LongestWait []time.Duration // longest time each philosopher was hungry
+	Starving    []int           // philosophers whose longest wait exceeded Config.Starving
+	// Stalled is set when the watchdog stopped the dinner. From outside, a
+	// deadlock (everyone blocked on a fork) and a livelock (everyone busy
+	// taking and dropping forks) look the same: hungry and not eating.
+	Stalled bool
+	Elapsed time.Duration
+}
+
+func (r Report) String() string {
+	var b strings.Builder
+	total, min, max := 0, -1, 0
+	for _, m := range r.Meals {
+		total += m
+		if min < 0 || m < min {
+			min = m
+		}
+		if m > max {
+			max = m
+		}
+	}
+	fmt.Fprintf(&b, "%-13s meals %v (total %d, min %d, max %d)", r.Strategy, r.Meals, total, min, max)
+	if r.Stalled {
+		fmt.Fprintf(&b, ", no progress (deadlock or livelock), stopped after %v", r.Elapsed.Round(time.Millisecond))
+	}
+	if len(r.Starving) > 0 {
+		fmt.Fprintf(&b, ", starving %v", r.Starving)
+	}
+	return b.String()
+}
+
+// Dine runs one dinner and reports how it went.
+func Dine(cfg Config) Report {
+	if cfg.Philosophers < 2 {
+		cfg.Philosophers = 5
+	}
+	if cfg.Duration <= 0 {
+		cfg.Duration = 2 * time.Second
+	}
+	if cfg.Strategy == nil {
+		cfg.Strategy = Ordered
+	}
+	if cfg.Think <= 0 {
+		cfg.Think = 10 * time.Millisecond
+	}
+	if cfg.Eat <= 0 {
+		cfg.Eat = 10 * time.Millisecond
+	}
+	if cfg.Watchdog <= 0 {
+		cfg.Watchdog = 500 * time.Millisecond
+	}
+	if cfg.Starving <= 0 {
+		cfg.Starving = cfg.Duration / 4
+	}
+	n := cfg.Philosophers
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Duration)
+	defer cancel()
+	tbl := cfg.Strategy.newTable(n, cfg.Reach)
+	report := Report{Strategy: cfg.Strategy.Name(), Meals: make([]int, n), LongestWait: make([]time.Duration, n)}
+
+	var meals, hungry int64
+	var wg sync.WaitGroup
+	start := time.Now()
+	for id := 0; id < n; id++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(cfg.Seed + int64(id)))
+			for {
+				if !sleep(ctx, time.Duration(rng.Int63n(int64(cfg.Think)))) {
+					return
+				}
+				atomic.AddInt64(&hungry, 1)
+				since := time.Now()
+				err := tbl.pickUp(ctx, id, rng)
+				atomic.AddInt64(&hungry, -1)
+				if wait := time.Since(since); wait > report.LongestWait[id] {
+					report.LongestWait[id] = wait
+				}
+				if err != nil {
+					return
+				}
+				ate := sleep(ctx, time.Duration(rng.Int63n(int64(cfg.Eat))))
+				tbl.putDown(id)
+				if !ate {
+					return // the dinner ended mid-meal; that meal does not count
+				}
+				report.Meals[id]++
+				atomic.AddInt64(&meals, 1)
+			}
+		}(id)
+	}
+
+	// The watchdog: if everyone is hungry and the meal count has not moved
+	// for a whole period, the dinner is stuck, whether in a deadlock or a
+	// livelock, and is stopped.
+	watchdog := time.NewTicker(cfg.Watchdog / 4)
+	defer watchdog.Stop()
+	lastMeals, lastProgress := int64(-1), time.Now()
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-watchdog.C:
+			m := atomic.LoadInt64(&meals)
+			if m != lastMeals {
+				lastMeals, lastProgress = m, time.Now()
+				continue
+			}
+			if atomic.LoadInt64(&hungry) == int64(n) && time.Since(lastProgress) >= cfg.Watchdog {
+				report.Stalled = true
+				report.Elapsed = time.Since(start)
+				cancel()
+			}
+		}
+	}
+	wg.Wait()
+	if !report.Stalled {
+		report.Elapsed = time.Since(start)
+	}
+	for id, wait := range report.LongestWait {
+		if wait > cfg.Starving {
+			report.Starving = append(report.Starving, id)
+		}
+	}
+	return report
+}
+
+// sleep waits for d, returning false if ctx is done first.
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// ==============================
+// Example
+// ==============================
+
+// TestDiningPhilosophers runs every strategy for the same dinner. The naive
+// strategy deadlocks within moments; the others keep everyone fed.
+func TestDiningPhilosophers() {
+	for _, s := range Strategies {
+		fmt.Println(Dine(Config{
+			Philosophers: 5,
+			Duration:     2 * time.Second,
+			Strategy:     s,
+			Reach:        5 * time.Millisecond,
+			Seed:         1,
+		}))
+	}
+	// Example Output (numbers vary from run to run):
+	// naive         meals [0 0 0 0 0] (total 0, min 0, max 0), no progress (deadlock or livelock), stopped after 626ms, starving [0 1 2 3 4]
+	// ordered       meals [70 83 93 104 70] (total 420, min 70, max 104)
+	// waiter        meals [70 70 71 69 69] (total 349, min 69, max 71)
+	// chandy-misra  meals [109 109 106 109 108] (total 541, min 106, max 109)
+	// trylock       meals [47 70 49 58 59] (total 283, min 47, max 70)
+	//
+	// Ordered is the least fair: P0 and P4 both reach for F0 first.
+	// Chandy-Misra eats the most because it never pauses between forks
+	// (Reach does not apply), and is the fairest, as the dirty-fork rule promises.
+}
@@ -0,0 +1,216 @@
+// raft-network.go
+//
+// This file provides the simulated network the Raft nodes talk over: every
+// message is delivered after a random latency, may be dropped, and never
+// crosses a partition or reaches a crashed node.
+
+package raft
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ==============================
+// Messages
+// ==============================
+//
+// Raft is usually described with two RPCs, RequestVote and AppendEntries.
+// Here each RPC is a pair of one-way messages, a request and a reply, so a
+// node never blocks waiting for a peer: it sends, goes back to its select
+// loop, and handles the reply whenever (and if ever) it arrives. That is also
+// what makes lost and late replies easy to simulate.
+
+// MsgKind is the type of a Message.
+type MsgKind int
+
+const (
+	MsgVote        MsgKind = iota // RequestVote
+	MsgVoteReply                  // RequestVote reply
+	MsgAppend                     // AppendEntries, also the leader's heartbeat
+	MsgAppendReply                // AppendEntries reply
+)
+
+func (k MsgKind) String() string {
+	switch k {
+	case MsgVote:
+		return "vote"
+	case MsgVoteReply:
+		return "vote-reply"
+	case MsgAppend:
+		return "append"
+	default:
+		return "append-reply"
+	}
+}
+
+// Message is one request or reply. Only the fields of its Kind are set.
+type Message struct {
+	Kind     MsgKind
+	From, To int
+	Term     int
+
+	// MsgVote
+	LastLogIndex, LastLogTerm int
+	// MsgVoteReply
+	Granted bool
+
+	// MsgAppend
+	PrevLogIndex, PrevLogTerm int
+	Entries                   []Entry
+	LeaderCommit              int
+	// MsgAppendReply. On success MatchIndex is the last index the follower
+	// now shares with the leader; on failure it is a hint of where to retry.
+	Success    bool
+	MatchIndex int
+}
+
+// ==============================
+// Simulated Network
+// ==============================
+
+// NetStats counts messages.
+type NetStats struct {
+	Sent, Delivered, Dropped int
+}
+
+// Network delivers messages between nodes. All methods are safe for
+// concurrent use.
+type Network struct {
+	mu         sync.Mutex
+	inboxes    []chan Message
+	minLatency time.Duration
+	maxLatency time.Duration
+	dropRate   float64
+	group      []int  // nodes can talk when they are in the same group
+	down       []bool // crashed nodes
+	rng        *rand.Rand
+	stats      NetStats
+}
+
+// NewNetwork returns a fully connected network of n nodes with no latency
+// and no drops.
+func NewNetwork(n int, seed int64) *Network {
+	nw := &Network{
+		inboxes: make([]chan Message, n),
+		group:   make([]int, n),
+		down:    make([]bool, n),
+		rng:     rand.New(rand.NewSource(seed)),
+	}
+	for i := range nw.inboxes {
+		nw.inboxes[i] = make(chan Message, 256)
+	}
+	return nw
+}
+
+// SetLatency makes every message take between min and max to arrive.
+func (nw *Network) SetLatency(min, max time.Duration) {
+	if max < min {
+		max = min
+	}
+	nw.mu.Lock()
+	nw.minLatency, nw.maxLatency = min, max
+	nw.mu.Unlock()
+}
+
+// SetDropRate makes the network lose a fraction p of the messages.
+func (nw *Network) SetDropRate(p float64) {
+	nw.mu.Lock()
+	nw.dropRate = p
+	nw.mu.Unlock()
+}
+
+// Partition splits the network: nodes can only reach nodes in the same
+// group. Nodes not listed in any group are cut off from everyone.
+func (nw *Network) Partition(groups ...[]int) {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	for i := range nw.group {
+		nw.group[i] = -1 - i // a group of its own
+	}
+	for g, ids := range groups {
+		for _, id := range ids {
+			if id >= 0 && id < len(nw.group) {
+				nw.group[id] = g
+			}
+		}
+	}
+}
+
+// Heal removes all partitions.
+func (nw *Network) Heal() {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	for i := range nw.group {
+		nw.group[i] = 0
+	}
+}
+
+// Stats returns the message counts so far.
+func (nw *Network) Stats() NetStats {
+	nw.mu.Lock()
+	defer nw.mu.Unlock()
+	return nw.stats
+}
+
+func (nw *Network) setDown(id int, down bool) {
+	nw.mu.Lock()
+	nw.down[id] = down
+	nw.mu.Unlock()
+}
+
+func (nw *Network) inbox(id int) <-chan Message {
+	return nw.inboxes[id]
+}
+
+// reachable reports whether a message from one node can reach another now.
+// The caller must hold nw.mu.
+func (nw *Network) reachable(from, to int) bool {
+	return !nw.down[from] && !nw.down[to] && nw.group[from] == nw.group[to]
+}
+
+// send delivers m after a random latency. The partition and crash checks
+// are made both when the message is sent and when it arrives, so a partition
+// also cuts off messages that were already in flight.
+func (nw *Network) send(m Message) {
+	nw.mu.Lock()
+	nw.stats.Sent++
+	if !nw.reachable(m.From, m.To) || nw.rng.Float64() < nw.dropRate {
+		nw.stats.Dropped++
+		nw.mu.Unlock()
+		return
+	}
+	delay := nw.minLatency
+	if span := nw.maxLatency - nw.minLatency; span > 0 {
+		delay += time.Duration(nw.rng.Int63n(int64(span)))
+	}
+	nw.mu.Unlock()
+
+	time.AfterFunc(delay, func() {
+		nw.mu.Lock()
+		defer nw.mu.Unlock()
+		if !nw.reachable(m.From, m.To) {
+			nw.stats.Dropped++
+			return
+		}
+		select {
+		case nw.inboxes[m.To] <- m:
+			nw.stats.Delivered++
+		default: // inbox full: the node is overloaded, drop it like a real network would
+			nw.stats.Dropped++
+		}
+	})
+}
+
+// drain discards messages waiting in a node's inbox, such as those that
+// arrived just before it crashed.
+func (nw *Network) drain(id int) {
+	for {
+		select {
+		case <-nw.inboxes[id]:
+		default:
+			return
+		}
+	}
+}
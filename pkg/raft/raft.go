@@ -0,0 +1,864 @@
+// raft.go
+//
+// This package implements the Raft consensus algorithm (leader election, log
+// replication and the commit index) with nodes as goroutines exchanging
+// messages over a simulated network. A Cluster can crash and restart nodes
+// and partition the network, and checks that Raft's safety guarantees hold.
+// cmd/raftsim scripts these failures from the command line.
+
+package raft
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ==============================
+// Raft in Brief
+// ==============================
+//
+// A cluster of N nodes keeps the same log of commands. Time is divided into
+// terms, and each term has at most one leader:
+//
+// 1. Election: a follower that hears nothing from a leader for a random
+//    election timeout becomes a candidate, starts a new term and asks for
+//    votes. Each node votes once per term, and only for candidates whose log
+//    is at least as up to date as its own. A majority of votes makes a leader.
+// 2. Replication: the leader appends client commands to its log and sends
+//    them to the followers in AppendEntries messages, which double as
+//    heartbeats. Each message carries the index and term of the entry before
+//    the new ones; a follower whose log does not match rejects it, and the
+//    leader retries from further back until the logs agree.
+// 3. Commit: once a majority stores an entry from the leader's current term,
+//    it is committed and will survive any future election, because every
+//    future leader needs votes from that majority. Nodes apply committed
+//    entries to their state machine, here a key-value map.
+//
+// A minority can never elect a leader or commit anything, so a partitioned
+// minority stalls, and when the partition heals its uncommitted entries are
+// overwritten by the majority's log.
+//
+// Each node is one goroutine running a select loop over its inbox and a
+// timer, in the style of the channels lessons. The node's state is also read
+// by Cluster (for Status and Propose), so it lives behind a mutex.
+
+// Entry is one log entry. An empty Command is the no-op a new leader appends
+// so that it can commit entries from earlier terms.
+type Entry struct {
+	Term    int
+	Command string
+}
+
+// Role is what a node currently is.
+type Role int
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	switch r {
+	case Candidate:
+		return "candidate"
+	case Leader:
+		return "leader"
+	default:
+		return "follower"
+	}
+}
+
+// Config describes a cluster.
+type Config struct {
+	Nodes int // defaults to 5
+	// A follower starts an election after a random timeout between
+	// ElectionTimeout and twice that. Defaults to 150ms.
+	ElectionTimeout time.Duration
+	Heartbeat       time.Duration // defaults to ElectionTimeout / 3
+	MinLatency      time.Duration // network latency, defaults to 1ms-5ms
+	MaxLatency      time.Duration
+	DropRate        float64
+	Seed            int64
+	// Logf, if not nil, receives elections, commits and failures as they
+	// happen.
+	Logf func(format string, args ...interface{})
+}
+
+func (c *Config) setDefaults() {
+	if c.Nodes < 1 {
+		c.Nodes = 5
+	}
+	if c.ElectionTimeout <= 0 {
+		c.ElectionTimeout = 150 * time.Millisecond
+	}
+	if c.Heartbeat <= 0 {
+		c.Heartbeat = c.ElectionTimeout / 3
+	}
+	if c.MinLatency <= 0 && c.MaxLatency <= 0 {
+		c.MinLatency, c.MaxLatency = time.Millisecond, 5*time.Millisecond
+	}
+}
+
+// ==============================
+// Node
+// ==============================
+
+// node is one Raft server.
+type node struct {
+	id      int
+	cluster *Cluster
+	net     *Network
+
+	mu sync.Mutex
+	// Persistent state: survives a crash.
+	term     int
+	votedFor int // -1 if none in this term
+	log      []Entry
+	// Volatile state: reset by a crash.
+	role        Role
+	leader      int // -1 if unknown
+	commitIndex int
+	lastApplied int
+	kv          map[string]string
+	votes       map[int]bool // candidate only
+	nextIndex   []int        // leader only
+	matchIndex  []int        // leader only
+	resetTimer  bool         // the loop must re-arm its timer
+	rng         *rand.Rand
+
+	stop chan struct{} // nil while crashed
+	done chan struct{}
+}
+
+func newNode(id int, c *Cluster) *node {
+	return &node{
+		id:       id,
+		cluster:  c,
+		net:      c.net,
+		votedFor: -1,
+		leader:   -1,
+		kv:       make(map[string]string),
+		rng:      rand.New(rand.NewSource(c.cfg.Seed + int64(id) + 1)),
+	}
+}
+
+// start runs the node's loop in a new goroutine.
+func (n *node) start() {
+	n.stop, n.done = make(chan struct{}), make(chan struct{})
+	go n.run(n.stop, n.done)
+}
+
+// crash stops the loop and forgets the volatile state.
+func (n *node) crash() {
+	close(n.stop)
+	<-n.done
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.stop = nil
+	n.role, n.leader = Follower, -1
+	n.commitIndex, n.lastApplied = 0, 0
+	n.kv = make(map[string]string)
+	n.votes, n.nextIndex, n.matchIndex = nil, nil, nil
+}
+
+func (n *node) up() bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.stop != nil
+}
+
+// run is the node's event loop: messages and timeouts, one at a time.
+func (n *node) run(stop <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	n.mu.Lock()
+	timer := time.NewTimer(n.timeout())
+	n.mu.Unlock()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case m := <-n.net.inbox(n.id):
+			n.mu.Lock()
+			n.handle(m)
+			reset, d := n.resetTimer, n.timeout()
+			n.resetTimer = false
+			n.mu.Unlock()
+			if reset {
+				if !timer.Stop() {
+					select {
+					case <-timer.C:
+					default:
+					}
+				}
+				timer.Reset(d)
+			}
+		case <-timer.C:
+			n.mu.Lock()
+			if n.role == Leader {
+				n.broadcastAppend()
+			} else {
+				n.startElection()
+			}
+			n.resetTimer = false
+			d := n.timeout()
+			n.mu.Unlock()
+			timer.Reset(d)
+		}
+	}
+}
+
+// timeout is how long the loop waits before acting on its own: the
+// heartbeat interval for a leader, a random election timeout otherwise.
+// The caller must hold n.mu.
+func (n *node) timeout() time.Duration {
+	cfg := n.cluster.cfg
+	if n.role == Leader {
+		return cfg.Heartbeat
+	}
+	return cfg.ElectionTimeout + time.Duration(n.rng.Int63n(int64(cfg.ElectionTimeout)))
+}
+
+func (n *node) logf(format string, args ...interface{}) {
+	n.cluster.logf("node %d (term %d): "+format, append([]interface{}{n.id, n.term}, args...)...)
+}
+
+func (n *node) send(m Message) {
+	m.From, m.Term = n.id, n.term
+	n.net.send(m)
+}
+
+func (n *node) lastLogIndexTerm() (int, int) {
+	if len(n.log) == 0 {
+		return 0, 0
+	}
+	return len(n.log), n.log[len(n.log)-1].Term
+}
+
+// termAt returns the term of the entry at index i (1-based), or 0 for i == 0.
+func (n *node) termAt(i int) int {
+	if i == 0 {
+		return 0
+	}
+	return n.log[i-1].Term
+}
+
+// becomeFollower moves to a newer term. The caller must hold n.mu.
+func (n *node) becomeFollower(term int) {
+	if n.role == Leader {
+		n.logf("saw term %d, stepping down", term)
+	}
+	if n.role != Follower {
+		n.resetTimer = true
+	}
+	n.term, n.votedFor = term, -1
+	n.role, n.leader = Follower, -1
+}
+
+// startElection makes the node a candidate in a new term. The caller must
+// hold n.mu.
+func (n *node) startElection() {
+	n.term++
+	n.role, n.leader, n.votedFor = Candidate, -1, n.id
+	n.votes = map[int]bool{n.id: true}
+	n.logf("election timeout, starting election")
+	if n.hasMajority(len(n.votes)) { // a cluster of one
+		n.becomeLeader()
+		return
+	}
+	lastIndex, lastTerm := n.lastLogIndexTerm()
+	for peer := 0; peer < n.cluster.cfg.Nodes; peer++ {
+		if peer != n.id {
+			n.send(Message{Kind: MsgVote, To: peer, LastLogIndex: lastIndex, LastLogTerm: lastTerm})
+		}
+	}
+}
+
+func (n *node) hasMajority(count int) bool {
+	return count > n.cluster.cfg.Nodes/2
+}
+
+// becomeLeader takes over after winning an election. The caller must hold n.mu.
+func (n *node) becomeLeader() {
+	n.role, n.leader = Leader, n.id
+	n.resetTimer = true
+	n.nextIndex = make([]int, n.cluster.cfg.Nodes)
+	n.matchIndex = make([]int, n.cluster.cfg.Nodes)
+	for i := range n.nextIndex {
+		n.nextIndex[i] = len(n.log) + 1
+	}
+	// A leader may only count replicas of entries from its own term, so
+	// without a new entry it could not commit what earlier leaders left.
+	n.log = append(n.log, Entry{Term: n.term})
+	n.matchIndex[n.id] = len(n.log)
+	n.logf("won election with %d votes, now leader", len(n.votes))
+	n.cluster.elected(n.term, n.id)
+	n.advanceCommit() // a cluster of one commits on its own
+	n.broadcastAppend()
+}
+
+// handle processes one message. The caller must hold n.mu.
+func (n *node) handle(m Message) {
+	if m.Term > n.term {
+		n.becomeFollower(m.Term)
+	}
+	switch m.Kind {
+	case MsgVote:
+		lastIndex, lastTerm := n.lastLogIndexTerm()
+		upToDate := m.LastLogTerm > lastTerm || (m.LastLogTerm == lastTerm && m.LastLogIndex >= lastIndex)
+		granted := m.Term == n.term && (n.votedFor == -1 || n.votedFor == m.From) && upToDate
+		if granted {
+			n.votedFor = m.From
+			n.resetTimer = true
+		}
+		n.send(Message{Kind: MsgVoteReply, To: m.From, Granted: granted})
+
+	case MsgVoteReply:
+		if n.role != Candidate || m.Term != n.term || !m.Granted {
+			return
+		}
+		n.votes[m.From] = true
+		if n.hasMajority(len(n.votes)) {
+			n.becomeLeader()
+		}
+
+	case MsgAppend:
+		n.handleAppend(m)
+
+	case MsgAppendReply:
+		if n.role != Leader || m.Term != n.term {
+			return
+		}
+		if m.Success {
+			if m.MatchIndex > n.matchIndex[m.From] {
+				n.matchIndex[m.From] = m.MatchIndex
+			}
+			n.nextIndex[m.From] = n.matchIndex[m.From] + 1
+			n.advanceCommit()
+			return
+		}
+		// The follower's log does not match at nextIndex-1: back up to its
+		// hint and try again at once rather than waiting for a heartbeat.
+		if next := m.MatchIndex + 1; next < n.nextIndex[m.From] {
+			n.nextIndex[m.From] = next
+		}
+		if n.nextIndex[m.From] < 1 {
+			n.nextIndex[m.From] = 1
+		}
+		n.sendAppend(m.From)
+	}
+}
+
+// handleAppend is the follower side of AppendEntries. The caller must hold n.mu.
+func (n *node) handleAppend(m Message) {
+	reply := Message{Kind: MsgAppendReply, To: m.From}
+	if m.Term < n.term { // a stale leader
+		n.send(reply)
+		return
+	}
+	if n.role != Follower {
+		n.role = Follower // a candidate that lost to m.From
+	}
+	if n.leader != m.From {
+		n.leader = m.From
+		n.logf("following node %d", m.From)
+	}
+	n.resetTimer = true
+
+	switch {
+	case m.PrevLogIndex > len(n.log):
+		reply.MatchIndex = len(n.log) // too short: retry from our end
+		n.send(reply)
+		return
+	case n.termAt(m.PrevLogIndex) != m.PrevLogTerm:
+		// Conflict: skip back over the whole conflicting term at once.
+		i, t := m.PrevLogIndex-1, n.termAt(m.PrevLogIndex)
+		for i > 0 && n.termAt(i) == t {
+			i--
+		}
+		reply.MatchIndex = i
+		n.send(reply)
+		return
+	}
+
+	for i, e := range m.Entries {
+		index := m.PrevLogIndex + 1 + i
+		if index <= len(n.log) {
+			if n.log[index-1].Term == e.Term {
+				continue // already have it (a duplicate or reordered message)
+			}
+			n.log = n.log[:index-1] // conflicting suffix: the leader's log wins
+		}
+		n.log = append(n.log, e)
+	}
+	last := m.PrevLogIndex + len(m.Entries)
+	if commit := min(m.LeaderCommit, last); commit > n.commitIndex {
+		n.commitIndex = commit
+		n.apply()
+	}
+	reply.Success, reply.MatchIndex = true, last
+	n.send(reply)
+}
+
+// broadcastAppend sends AppendEntries to every follower. The caller must
+// hold n.mu.
+func (n *node) broadcastAppend() {
+	for peer := 0; peer < n.cluster.cfg.Nodes; peer++ {
+		if peer != n.id {
+			n.sendAppend(peer)
+		}
+	}
+}
+
+// sendAppend sends a follower everything from its nextIndex on. The entries
+// are copied: the receiver must not share the leader's backing array.
+// The caller must hold n.mu.
+func (n *node) sendAppend(peer int) {
+	prev := n.nextIndex[peer] - 1
+	entries := append([]Entry(nil), n.log[prev:]...)
+	n.send(Message{
+		Kind:         MsgAppend,
+		To:           peer,
+		PrevLogIndex: prev,
+		PrevLogTerm:  n.termAt(prev),
+		Entries:      entries,
+		LeaderCommit: n.commitIndex,
+	})
+}
+
+// advanceCommit commits the highest entry of the current term that a
+// majority stores. The caller must hold n.mu.
+func (n *node) advanceCommit() {
+	for index := len(n.log); index > n.commitIndex; index-- {
+		if n.log[index-1].Term != n.term {
+			return // terms only decrease going back
+		}
+		count := 0
+		for _, match := range n.matchIndex {
+			if match >= index {
+				count++
+			}
+		}
+		if n.hasMajority(count) {
+			n.commitIndex = index
+			n.apply()
+			return
+		}
+	}
+}
+
+// apply runs newly committed commands ("key=value") against the key-value
+// map. The caller must hold n.mu.
+func (n *node) apply() {
+	for n.lastApplied < n.commitIndex {
+		n.lastApplied++
+		e := n.log[n.lastApplied-1]
+		if e.Command == "" {
+			continue
+		}
+		if k, v, ok := strings.Cut(e.Command, "="); ok {
+			n.kv[k] = v
+		}
+		if n.role == Leader {
+			n.logf("committed %d: %s", n.lastApplied, e.Command)
+		}
+	}
+}
+
+// propose appends cmd to the log if this node is the leader.
+func (n *node) propose(cmd string) (index int, ok bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.stop == nil || n.role != Leader {
+		return 0, false
+	}
+	n.log = append(n.log, Entry{Term: n.term, Command: cmd})
+	n.matchIndex[n.id] = len(n.log)
+	n.broadcastAppend()
+	return len(n.log), true
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// ==============================
+// Cluster
+// ==============================
+
+// ErrNoLeader is returned by Propose when no reachable leader exists.
+var ErrNoLeader = errors.New("raft: no leader")
+
+// Cluster is a set of nodes on one Network. Create it with NewCluster.
+type Cluster struct {
+	cfg   Config
+	net   *Network
+	nodes []*node
+	start time.Time
+
+	mu      sync.Mutex
+	leaders map[int]int // term -> leader, to check election safety
+	unsafe  []string
+}
+
+// NewCluster creates and starts a cluster.
+func NewCluster(cfg Config) *Cluster {
+	cfg.setDefaults()
+	c := &Cluster{
+		cfg:     cfg,
+		net:     NewNetwork(cfg.Nodes, cfg.Seed),
+		start:   time.Now(),
+		leaders: make(map[int]int),
+	}
+	c.net.SetLatency(cfg.MinLatency, cfg.MaxLatency)
+	c.net.SetDropRate(cfg.DropRate)
+	for i := 0; i < cfg.Nodes; i++ {
+		c.nodes = append(c.nodes, newNode(i, c))
+	}
+	for _, n := range c.nodes {
+		n.start()
+	}
+	return c
+}
+
+// Network returns the cluster's network, to set latency, drops and
+// partitions.
+func (c *Cluster) Network() *Network {
+	return c.net
+}
+
+// Size returns the number of nodes.
+func (c *Cluster) Size() int {
+	return len(c.nodes)
+}
+
+func (c *Cluster) logf(format string, args ...interface{}) {
+	if c.cfg.Logf != nil {
+		elapsed := time.Since(c.start).Round(time.Millisecond)
+		c.cfg.Logf("%6v "+format, append([]interface{}{elapsed}, args...)...)
+	}
+}
+
+// elected records a leader and flags a second leader in the same term.
+func (c *Cluster) elected(term, id int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if other, ok := c.leaders[term]; ok && other != id {
+		c.unsafe = append(c.unsafe, fmt.Sprintf("term %d has two leaders: %d and %d", term, other, id))
+	}
+	c.leaders[term] = id
+}
+
+// Stop stops every running node.
+func (c *Cluster) Stop() {
+	for i, n := range c.nodes {
+		if n.up() {
+			c.net.setDown(i, true)
+			n.crash()
+		}
+	}
+}
+
+// Crash stops node id. Its term, vote and log survive, as if on disk.
+func (c *Cluster) Crash(id int) error {
+	if err := c.checkID(id); err != nil {
+		return err
+	}
+	n := c.nodes[id]
+	if !n.up() {
+		return fmt.Errorf("raft: node %d is already down", id)
+	}
+	c.net.setDown(id, true)
+	n.crash()
+	c.net.drain(id)
+	c.logf("node %d crashed", id)
+	return nil
+}
+
+// Restart starts a crashed node again.
+func (c *Cluster) Restart(id int) error {
+	if err := c.checkID(id); err != nil {
+		return err
+	}
+	n := c.nodes[id]
+	if n.up() {
+		return fmt.Errorf("raft: node %d is already up", id)
+	}
+	c.net.drain(id)
+	c.net.setDown(id, false)
+	n.start()
+	c.logf("node %d restarted", id)
+	return nil
+}
+
+func (c *Cluster) checkID(id int) error {
+	if id < 0 || id >= len(c.nodes) {
+		return fmt.Errorf("raft: no node %d", id)
+	}
+	return nil
+}
+
+// Leader returns the running leader with the highest term, or -1. During a
+// partition an old leader may still believe it leads; it has a lower term.
+func (c *Cluster) Leader() int {
+	leader, term := -1, -1
+	for _, s := range c.Status() {
+		if s.Up && s.Role == Leader && s.Term > term {
+			leader, term = s.ID, s.Term
+		}
+	}
+	return leader
+}
+
+// Propose submits cmd, of the form "key=value", to the current leader and
+// returns its log index. The command is committed later, if at all.
+func (c *Cluster) Propose(cmd string) (int, error) {
+	leader := c.Leader()
+	if leader < 0 {
+		return 0, ErrNoLeader
+	}
+	return c.ProposeAt(leader, cmd)
+}
+
+// ProposeAt submits cmd to node id, which must believe it is the leader.
+func (c *Cluster) ProposeAt(id int, cmd string) (int, error) {
+	if err := c.checkID(id); err != nil {
+		return 0, err
+	}
+	index, ok := c.nodes[id].propose(cmd)
+	if !ok {
+		return 0, fmt.Errorf("raft: node %d is not a leader", id)
+	}
+	c.logf("node %d: appended %d: %s", id, index, cmd)
+	return index, nil
+}
+
+// WaitLeader waits up to timeout for a leader and returns it, or -1.
+func (c *Cluster) WaitLeader(timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		if l := c.Leader(); l >= 0 || time.Now().After(deadline) {
+			return l
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// WaitConverged waits up to timeout until the leader has committed its whole
+// log and every running node has applied all of it.
+func (c *Cluster) WaitConverged(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for !time.Now().After(deadline) {
+		if c.converged() {
+			return true
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return false
+}
+
+func (c *Cluster) converged() bool {
+	status := c.Status()
+	leader := c.Leader()
+	if leader < 0 {
+		return false
+	}
+	want := status[leader]
+	if want.Commit != want.LogLen {
+		return false
+	}
+	for _, s := range status {
+		if s.Up && (s.Term != want.Term || s.LogLen != want.LogLen || s.Applied != want.LogLen) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check verifies Raft's safety properties: at most one leader per term, and
+// committed entries identical on every node that has them.
+func (c *Cluster) Check() error {
+	c.mu.Lock()
+	problems := append([]string(nil), c.unsafe...)
+	c.mu.Unlock()
+
+	type committed struct {
+		id      int
+		entries []Entry
+	}
+	var logs []committed
+	for _, n := range c.nodes {
+		n.mu.Lock()
+		logs = append(logs, committed{n.id, append([]Entry(nil), n.log[:n.commitIndex]...)})
+		n.mu.Unlock()
+	}
+	for i := 0; i < len(logs); i++ {
+		for j := i + 1; j < len(logs); j++ {
+			a, b := logs[i], logs[j]
+			for k := 0; k < min(len(a.entries), len(b.entries)); k++ {
+				if a.entries[k] != b.entries[k] {
+					problems = append(problems, fmt.Sprintf("nodes %d and %d committed different entries at %d: %v vs %v",
+						a.id, b.id, k+1, a.entries[k], b.entries[k]))
+					break
+				}
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return errors.New("raft: " + strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// NodeStatus is a snapshot of one node.
+type NodeStatus struct {
+	ID      int
+	Up      bool
+	Role    Role
+	Term    int
+	Leader  int // -1 if unknown
+	LogLen  int
+	Commit  int
+	Applied int
+	KV      map[string]string
+}
+
+// Status returns a snapshot of every node.
+func (c *Cluster) Status() []NodeStatus {
+	status := make([]NodeStatus, len(c.nodes))
+	for i, n := range c.nodes {
+		n.mu.Lock()
+		kv := make(map[string]string, len(n.kv))
+		for k, v := range n.kv {
+			kv[k] = v
+		}
+		status[i] = NodeStatus{
+			ID: n.id, Up: n.stop != nil, Role: n.role, Term: n.term, Leader: n.leader,
+			LogLen: len(n.log), Commit: n.commitIndex, Applied: n.lastApplied, KV: kv,
+		}
+		n.mu.Unlock()
+	}
+	return status
+}
+
+// PrintStatus writes Status as a table.
+func (c *Cluster) PrintStatus(w io.Writer) {
+	fmt.Fprintf(w, "%-4s %-5s %-9s %4s %6s %4s %6s  %s\n", "node", "state", "role", "term", "leader", "log", "commit", "data")
+	for _, s := range c.Status() {
+		state, leader := "up", "-"
+		if !s.Up {
+			state = "down"
+		}
+		if s.Leader >= 0 {
+			leader = fmt.Sprint(s.Leader)
+		}
+		fmt.Fprintf(w, "%-4d %-5s %-9s %4d %6s %4d %6d  %s\n", s.ID, state, s.Role, s.Term, leader, s.LogLen, s.Commit, formatKV(s.KV))
+	}
+	st := c.net.Stats()
+	fmt.Fprintf(w, "network: %d sent, %d delivered, %d dropped\n", st.Sent, st.Delivered, st.Dropped)
+}
+
+func formatKV(kv map[string]string) string {
+	keys := make([]string, 0, len(kv))
+	for k := range kv {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + kv[k]
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
+
+// ==============================
+// Example
+// ==============================
+
+// waitLeaderAmong waits up to timeout until the leader Leader reports is
+// one of ids and returns it, or -1. While a partition lasts, an old leader
+// cut off from the majority is reported until the majority elects its own.
+func waitLeaderAmong(c *Cluster, ids []int, timeout time.Duration) int {
+	deadline := time.Now().Add(timeout)
+	for {
+		l := c.WaitLeader(time.Until(deadline))
+		for _, id := range ids {
+			if l == id {
+				return l
+			}
+		}
+		if time.Now().After(deadline) {
+			return -1
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestRaft elects a leader, replicates a few commands, partitions the leader
+// into a minority and heals the partition, checking safety at the end.
+func TestRaft() {
+	c := NewCluster(Config{Nodes: 5, Seed: 1})
+	defer c.Stop()
+
+	old := c.WaitLeader(2 * time.Second)
+	fmt.Println("leader:", old)
+	if old < 0 {
+		return
+	}
+	for _, cmd := range []string{"x=1", "y=2"} {
+		if _, err := c.Propose(cmd); err != nil {
+			fmt.Println("propose:", err)
+			return
+		}
+	}
+	fmt.Println("converged:", c.WaitConverged(2*time.Second))
+
+	// Cut the leader and one follower off from the other three.
+	follower := (old + 1) % c.Size()
+	var majority []int
+	for i := 0; i < c.Size(); i++ {
+		if i != old && i != follower {
+			majority = append(majority, i)
+		}
+	}
+	c.Network().Partition([]int{old, follower}, majority)
+	c.ProposeAt(old, "x=lost") // the old leader cannot reach a majority
+
+	// The majority times out and elects a new leader.
+	leader := waitLeaderAmong(c, majority, 2*time.Second)
+	fmt.Println("new leader is in the majority:", leader >= 0)
+	if _, err := c.ProposeAt(leader, "x=3"); err != nil {
+		fmt.Println("propose:", err)
+		return
+	}
+
+	c.Network().Heal()
+	fmt.Println("converged after heal:", c.WaitConverged(2*time.Second))
+	for _, s := range c.Status() {
+		fmt.Printf("node %d: %s\n", s.ID, formatKV(s.KV))
+	}
+	fmt.Println("safety check:", c.Check())
+	// leader: 4
+	// converged: true
+	// new leader is in the majority: true
+	// converged after heal: true
+	// node 0: {x=3 y=2}
+	// node 1: {x=3 y=2}
+	// node 2: {x=3 y=2}
+	// node 3: {x=3 y=2}
+	// node 4: {x=3 y=2}
+	// safety check: <nil>
+	// x=lost was never committed: when the partition healed, the old leader
+	// saw the higher term, stepped down, and its log was overwritten.
+}
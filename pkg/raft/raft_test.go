@@ -0,0 +1,65 @@
+// raft_test.go
+//
+// Tests for the Raft simulation. The cluster runs on real goroutines and
+// timers, so the tests wait for states rather than expecting exact timings.
+
+package raft
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPartitionedLeaderLosesUncommittedWrite(t *testing.T) {
+	c := NewCluster(Config{Nodes: 5, Seed: 1})
+	defer c.Stop()
+
+	// 1. Elect a leader and replicate a write.
+	old := c.WaitLeader(2 * time.Second)
+	if old < 0 {
+		t.Fatal("no leader elected")
+	}
+	if _, err := c.Propose("x=1"); err != nil {
+		t.Fatalf("Propose: %v", err)
+	}
+	if !c.WaitConverged(2 * time.Second) {
+		t.Fatal("cluster did not converge before the partition")
+	}
+
+	// 2. Partition the leader into the minority and propose to it.
+	follower := (old + 1) % c.Size()
+	var majority []int
+	for i := 0; i < c.Size(); i++ {
+		if i != old && i != follower {
+			majority = append(majority, i)
+		}
+	}
+	c.Network().Partition([]int{old, follower}, majority)
+	if _, err := c.ProposeAt(old, "x=lost"); err != nil {
+		t.Fatalf("ProposeAt old leader: %v", err)
+	}
+	leader := waitLeaderAmong(c, majority, 2*time.Second)
+	if leader < 0 {
+		t.Fatal("the majority elected no leader")
+	}
+	if _, err := c.ProposeAt(leader, "x=3"); err != nil {
+		t.Fatalf("ProposeAt new leader: %v", err)
+	}
+
+	// 3. Heal the partition and 4. wait for convergence.
+	c.Network().Heal()
+	if !c.WaitConverged(2 * time.Second) {
+		t.Fatal("cluster did not converge after heal")
+	}
+	if err := c.Check(); err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	status := c.Status()
+	want := map[string]string{"x": "3"}
+	for _, s := range status {
+		if !reflect.DeepEqual(s.KV, want) {
+			t.Errorf("node %d: %s, want %s", s.ID, formatKV(s.KV), formatKV(want))
+		}
+	}
+}
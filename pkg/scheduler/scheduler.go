@@ -0,0 +1,700 @@
+// scheduler.go
+//
+// This package is a deterministic, tick-based simulator of Go's G-M-P
+// scheduler. It is a teaching tool: it models the decisions the runtime makes
+// (run queues, work stealing, syscall hand-off, preemption) and prints them
+// step by step, without any of the real runtime's timing noise.
+
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ==============================
+// The G-M-P Model
+// ==============================
+//
+// The Go runtime multiplexes goroutines onto OS threads using three entities:
+//
+//   G - a goroutine: a function, its stack and its state.
+//   M - a machine: an OS thread that executes code.
+//   P - a processor: the right to run Go code. There are GOMAXPROCS of them.
+//       Each P owns a local run queue of runnable Gs.
+//
+// An M must hold a P to run a G:
+//
+//       global run queue: [G7 G8]
+//
+//       P0 ---- M0 ---- G1 (running)       P1 ---- M1 ---- G4 (running)
+//       |                                  |
+//       local: [G2 G3]                     local: [G5 G6]
+//
+//       M2 ---- G9 (blocked in a syscall, holds no P)
+//
+// Scheduling rules modelled here:
+//
+// 1. Run queues: a P runs Gs from its local queue. New goroutines spawned by
+//    a running G go to that P's local queue; goroutines created up front and
+//    preempted goroutines go to the global queue.
+// 2. Fairness: every 61st schedule, a P checks the global queue first so that
+//    it cannot starve behind busy local queues.
+// 3. Work stealing: a P with nothing local and nothing global steals half of
+//    another P's local queue.
+// 4. Syscall hand-off: a G entering a blocking syscall keeps its M, but the P
+//    is handed to another M (an idle one, or a new thread) so other Gs keep
+//    running. When the syscall returns, the G looks for an idle P, and
+//    otherwise goes to the global queue while its M parks.
+// 5. Preemption: a G that runs longer than its time slice is preempted and
+//    put on the global queue.
+
+// ==============================
+// Workload
+// ==============================
+
+type opKind int
+
+const (
+	opCompute opKind = iota
+	opSyscall
+	opSpawn
+)
+
+// Op is one step of a scripted goroutine.
+type Op struct {
+	kind  opKind
+	ticks int
+	child *Goroutine
+}
+
+// Compute keeps the goroutine busy on its P for n ticks (at least one).
+func Compute(n int) Op { return Op{kind: opCompute, ticks: atLeastOne(n)} }
+
+// Syscall blocks the goroutine (and its M) in a system call for n ticks
+// (at least one).
+func Syscall(n int) Op { return Op{kind: opSyscall, ticks: atLeastOne(n)} }
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
+
+// Spawn starts a new goroutine on the current P's local queue.
+// It takes no time.
+func Spawn(name string, ops ...Op) Op {
+	return Op{kind: opSpawn, child: &Goroutine{Name: name, Ops: ops}}
+}
+
+// Goroutine is a scripted goroutine: it becomes runnable at tick Start and
+// then executes Ops in order.
+type Goroutine struct {
+	Name  string
+	Start int
+	Ops   []Op
+}
+
+// Config controls the simulated runtime.
+type Config struct {
+	// Procs is the number of Ps (GOMAXPROCS).
+	Procs int
+	// TimeSlice is how many ticks a G may run before being preempted.
+	// Zero disables preemption.
+	TimeSlice int
+	// LocalQueueSize is the capacity of each P's local run queue.
+	// When full, half of it spills to the global queue.
+	LocalQueueSize int
+	// DisableStealing turns work stealing off, to show what it buys.
+	DisableStealing bool
+}
+
+// ==============================
+// Runtime State
+// ==============================
+
+type gState int
+
+const (
+	gRunnable gState = iota
+	gRunning
+	gSyscall
+	gDead
+)
+
+type g struct {
+	id        int
+	name      string
+	ops       []Op
+	pc        int // index of the current op
+	remaining int // ticks left in the current op
+	slice     int // ticks run since last scheduled
+	state     gState
+}
+
+type p struct {
+	id        int
+	runq      []*g
+	cur       *g
+	m         *m
+	schedtick int
+	busy      int
+}
+
+type m struct {
+	id      int
+	p       *p
+	blocked *g // the G this M is running a syscall for
+}
+
+// ==============================
+// Trace
+// ==============================
+
+// EventKind classifies trace events.
+type EventKind string
+
+// Event kinds emitted by the simulator.
+const (
+	EventCreate   EventKind = "create"
+	EventRun      EventKind = "run"
+	EventFinish   EventKind = "finish"
+	EventPreempt  EventKind = "preempt"
+	EventSteal    EventKind = "steal"
+	EventGlobal   EventKind = "global"
+	EventSyscall  EventKind = "syscall"
+	EventHandoff  EventKind = "handoff"
+	EventReturn   EventKind = "return"
+	EventWake     EventKind = "wake"
+	EventIdle     EventKind = "idle"
+	EventOverflow EventKind = "overflow"
+)
+
+// Event is one scheduling decision.
+type Event struct {
+	Tick   int
+	Kind   EventKind
+	Detail string
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("t=%-3d %-8s %s", e.Tick, e.Kind, e.Detail)
+}
+
+// Stats summarises a run.
+type Stats struct {
+	Ticks       int
+	Threads     int
+	Steals      int
+	Preemptions int
+	Handoffs    int
+	Busy        []int // ticks each P spent running a G
+}
+
+// Result is the outcome of Run: the trace, stats and an ASCII timeline.
+type Result struct {
+	Events []Event
+	Stats  Stats
+
+	timeline [][]byte // one row per P, one column per tick
+	syscalls map[string][]byte
+	sysOrder []string
+	names    []string
+}
+
+// ==============================
+// Simulator
+// ==============================
+
+// Simulator runs a scripted workload. Create it with New.
+type Simulator struct {
+	cfg    Config
+	ps     []*p
+	ms     []*m
+	idleMs []*m
+	global []*g
+	gs     []*g
+	script []Goroutine
+	tick   int
+	result *Result
+}
+
+// New returns a simulator for the given configuration.
+func New(cfg Config) *Simulator {
+	if cfg.Procs <= 0 {
+		cfg.Procs = 1
+	}
+	if cfg.LocalQueueSize <= 0 {
+		cfg.LocalQueueSize = 256
+	}
+	s := &Simulator{cfg: cfg}
+	for i := 0; i < cfg.Procs; i++ {
+		s.ps = append(s.ps, &p{id: i})
+	}
+	return s
+}
+
+// Go adds a scripted goroutine to the workload.
+func (s *Simulator) Go(gr Goroutine) {
+	s.script = append(s.script, gr)
+}
+
+// Run simulates until every goroutine has finished or maxTicks have passed.
+func (s *Simulator) Run(maxTicks int) *Result {
+	s.result = &Result{syscalls: make(map[string][]byte)}
+	s.result.timeline = make([][]byte, len(s.ps))
+
+	for s.tick = 0; s.tick < maxTicks; s.tick++ {
+		s.startScripted()
+		s.advanceSyscalls()
+		s.wakeIdlePs()
+		for _, pp := range s.ps {
+			s.step(pp)
+		}
+		s.recordSyscalls()
+		if s.done() {
+			s.tick++
+			break
+		}
+	}
+
+	s.result.Stats.Ticks = s.tick
+	s.result.Stats.Threads = len(s.ms)
+	for _, pp := range s.ps {
+		s.result.Stats.Busy = append(s.result.Stats.Busy, pp.busy)
+	}
+	for _, gg := range s.gs {
+		s.result.names = append(s.result.names, fmt.Sprintf("%c=%s", label(gg), gg.name))
+	}
+	return s.result
+}
+
+func (s *Simulator) emit(kind EventKind, format string, args ...any) {
+	s.result.Events = append(s.result.Events, Event{Tick: s.tick, Kind: kind, Detail: fmt.Sprintf(format, args...)})
+}
+
+// newG creates a G and returns it in the runnable state.
+func (s *Simulator) newG(gr *Goroutine) *g {
+	gg := &g{id: len(s.gs), name: gr.Name, ops: gr.Ops}
+	s.gs = append(s.gs, gg)
+	gg.resetOp()
+	return gg
+}
+
+// computing reports whether the G's current op is a Compute.
+func (gg *g) computing() bool {
+	return gg.pc < len(gg.ops) && gg.ops[gg.pc].kind == opCompute
+}
+
+func (gg *g) resetOp() {
+	if gg.pc < len(gg.ops) {
+		gg.remaining = gg.ops[gg.pc].ticks
+	}
+}
+
+// startScripted puts goroutines whose start tick has come on the global queue.
+func (s *Simulator) startScripted() {
+	for i := range s.script {
+		if s.script[i].Start == s.tick {
+			gg := s.newG(&s.script[i])
+			s.global = append(s.global, gg)
+			s.emit(EventCreate, "%s -> global queue", gg.name)
+		}
+	}
+}
+
+// advanceSyscalls progresses every blocked M. A G whose syscall finished
+// tries to grab an idle P; otherwise it goes to the global queue and its M parks.
+func (s *Simulator) advanceSyscalls() {
+	for _, mm := range s.ms {
+		gg := mm.blocked
+		if gg == nil {
+			continue
+		}
+		gg.remaining--
+		if gg.remaining > 0 {
+			continue
+		}
+		mm.blocked = nil
+		gg.pc++
+		gg.resetOp()
+		gg.state = gRunnable
+		if pp := s.idleP(); pp != nil {
+			pp.m = mm
+			mm.p = pp
+			pp.runq = append([]*g{gg}, pp.runq...)
+			s.emit(EventReturn, "%s back from syscall, M%d acquires idle P%d", gg.name, mm.id, pp.id)
+			continue
+		}
+		s.global = append(s.global, gg)
+		s.idleMs = append(s.idleMs, mm)
+		s.emit(EventReturn, "%s back from syscall, no idle P: -> global queue, M%d parks", gg.name, mm.id)
+	}
+}
+
+// wakeIdlePs gives an M to every P that has no M while there is work to do.
+func (s *Simulator) wakeIdlePs() {
+	for _, pp := range s.ps {
+		if pp.m == nil && s.hasWork(pp) {
+			mm := s.getM()
+			mm.p = pp
+			pp.m = mm
+			s.emit(EventWake, "P%d woken on M%d", pp.id, mm.id)
+		}
+	}
+}
+
+func (s *Simulator) hasWork(pp *p) bool {
+	if len(pp.runq) > 0 || len(s.global) > 0 {
+		return true
+	}
+	if s.cfg.DisableStealing {
+		return false
+	}
+	for _, other := range s.ps {
+		if len(other.runq) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// idleP returns a P without an M, or nil.
+func (s *Simulator) idleP() *p {
+	for _, pp := range s.ps {
+		if pp.m == nil {
+			return pp
+		}
+	}
+	return nil
+}
+
+// getM returns a parked M, or creates a new thread.
+func (s *Simulator) getM() *m {
+	if n := len(s.idleMs); n > 0 {
+		mm := s.idleMs[n-1]
+		s.idleMs = s.idleMs[:n-1]
+		return mm
+	}
+	mm := &m{id: len(s.ms)}
+	s.ms = append(s.ms, mm)
+	return mm
+}
+
+// step runs one tick on a P.
+func (s *Simulator) step(pp *p) {
+	mark := byte('.')
+	defer func() { s.result.timeline[pp.id] = append(s.result.timeline[pp.id], mark) }()
+
+	if pp.m == nil {
+		return
+	}
+	if pp.cur == nil {
+		pp.cur = s.findRunnable(pp)
+		if pp.cur == nil {
+			return
+		}
+	}
+
+	// Zero-time ops (spawns) and syscalls happen before the G computes.
+	for pp.cur != nil && !pp.cur.computing() {
+		gg := pp.cur
+		if gg.pc >= len(gg.ops) {
+			gg.pc--
+			if !s.advance(pp, gg) {
+				pp.cur = s.findRunnable(pp)
+			}
+			continue
+		}
+		op := gg.ops[gg.pc]
+		if op.kind == opSyscall {
+			s.enterSyscall(pp, gg)
+			return
+		}
+		child := s.newG(op.child)
+		s.runqPut(pp, child)
+		s.emit(EventCreate, "%s spawns %s -> P%d local queue", gg.name, child.name, pp.id)
+		if !s.advance(pp, gg) {
+			pp.cur = s.findRunnable(pp)
+		}
+	}
+	if pp.cur == nil {
+		return
+	}
+
+	gg := pp.cur
+	gg.remaining--
+	gg.slice++
+	pp.busy++
+	mark = label(gg)
+
+	if gg.remaining == 0 {
+		s.advance(pp, gg)
+		return
+	}
+	if s.cfg.TimeSlice > 0 && gg.slice >= s.cfg.TimeSlice {
+		gg.state = gRunnable
+		pp.cur = nil
+		s.global = append(s.global, gg)
+		s.result.Stats.Preemptions++
+		s.emit(EventPreempt, "%s used its %d-tick slice on P%d -> global queue", gg.name, s.cfg.TimeSlice, pp.id)
+	}
+}
+
+// advance moves gg past its current op. It reports whether gg is still
+// running on pp.
+func (s *Simulator) advance(pp *p, gg *g) bool {
+	gg.pc++
+	gg.resetOp()
+	if gg.pc < len(gg.ops) {
+		return true
+	}
+	gg.state = gDead
+	pp.cur = nil
+	s.emit(EventFinish, "%s finished on P%d", gg.name, pp.id)
+	return false
+}
+
+// enterSyscall blocks gg and its M, handing the P off to another M if there
+// is other work for it to do.
+func (s *Simulator) enterSyscall(pp *p, gg *g) {
+	mm := pp.m
+	gg.state = gSyscall
+	mm.blocked = gg
+	mm.p = nil
+	pp.m = nil
+	pp.cur = nil
+	s.emit(EventSyscall, "%s enters syscall on M%d, releasing P%d", gg.name, mm.id, pp.id)
+
+	if !s.hasWork(pp) {
+		s.emit(EventIdle, "P%d has no work and stays idle", pp.id)
+		return
+	}
+	next := s.getM()
+	next.p = pp
+	pp.m = next
+	s.result.Stats.Handoffs++
+	s.emit(EventHandoff, "P%d handed off to M%d", pp.id, next.id)
+}
+
+// findRunnable implements the lookup order of the runtime's findrunnable:
+// (occasionally) global, local, global, steal.
+func (s *Simulator) findRunnable(pp *p) *g {
+	pp.schedtick++
+	var gg *g
+	if pp.schedtick%61 == 0 && len(s.global) > 0 {
+		gg = s.global[0]
+		s.global = s.global[1:]
+		s.emit(EventGlobal, "P%d fairness check takes %s from global queue", pp.id, gg.name)
+	}
+	if gg == nil && len(pp.runq) > 0 {
+		gg = pp.runq[0]
+		pp.runq = pp.runq[1:]
+	}
+	if gg == nil && len(s.global) > 0 {
+		gg = s.globalGrab(pp)
+	}
+	if gg == nil && !s.cfg.DisableStealing {
+		gg = s.steal(pp)
+	}
+	if gg == nil {
+		s.emit(EventIdle, "P%d found no work, M%d parks", pp.id, pp.m.id)
+		s.idleMs = append(s.idleMs, pp.m)
+		pp.m.p = nil
+		pp.m = nil
+		return nil
+	}
+	gg.state = gRunning
+	gg.slice = 0
+	s.emit(EventRun, "P%d runs %s", pp.id, gg.name)
+	return gg
+}
+
+// globalGrab takes a fair share of the global queue: one G to run and a
+// batch for the local queue.
+func (s *Simulator) globalGrab(pp *p) *g {
+	n := len(s.global)/len(s.ps) + 1
+	if n > len(s.global) {
+		n = len(s.global)
+	}
+	if half := s.cfg.LocalQueueSize / 2; n > half {
+		n = half
+	}
+	batch := s.global[:n]
+	s.global = s.global[n:]
+	pp.runq = append(pp.runq, batch[1:]...)
+	s.emit(EventGlobal, "P%d takes %s from global queue", pp.id, names(batch))
+	return batch[0]
+}
+
+// steal takes half of the first non-empty local queue after pp.
+func (s *Simulator) steal(pp *p) *g {
+	for i := 1; i < len(s.ps); i++ {
+		victim := s.ps[(pp.id+i)%len(s.ps)]
+		if len(victim.runq) == 0 {
+			continue
+		}
+		n := (len(victim.runq) + 1) / 2
+		stolen := victim.runq[:n]
+		victim.runq = append([]*g(nil), victim.runq[n:]...)
+		pp.runq = append(pp.runq, stolen[1:]...)
+		s.result.Stats.Steals++
+		s.emit(EventSteal, "P%d steals %s from P%d", pp.id, names(stolen), victim.id)
+		return stolen[0]
+	}
+	return nil
+}
+
+// runqPut adds gg to pp's local queue, spilling half to the global queue
+// when the local queue is full.
+func (s *Simulator) runqPut(pp *p, gg *g) {
+	if len(pp.runq) >= s.cfg.LocalQueueSize {
+		n := len(pp.runq) / 2
+		s.global = append(s.global, pp.runq[:n]...)
+		pp.runq = append([]*g(nil), pp.runq[n:]...)
+		s.emit(EventOverflow, "P%d local queue full, moved %d Gs to global queue", pp.id, n)
+	}
+	pp.runq = append(pp.runq, gg)
+}
+
+// recordSyscalls adds one timeline column for every goroutine in a syscall.
+func (s *Simulator) recordSyscalls() {
+	for _, mm := range s.ms {
+		row := fmt.Sprintf("M%d", mm.id)
+		if _, ok := s.result.syscalls[row]; !ok {
+			s.result.sysOrder = append(s.result.sysOrder, row)
+			s.result.syscalls[row] = []byte(strings.Repeat(" ", s.tick))
+		}
+		mark := byte(' ')
+		if mm.blocked != nil {
+			mark = label(mm.blocked)
+		}
+		s.result.syscalls[row] = append(s.result.syscalls[row], mark)
+	}
+}
+
+// done reports whether every goroutine has finished and none are pending.
+func (s *Simulator) done() bool {
+	for _, gr := range s.script {
+		if gr.Start > s.tick {
+			return false
+		}
+	}
+	for _, gg := range s.gs {
+		if gg.state != gDead {
+			return false
+		}
+	}
+	return true
+}
+
+// ==============================
+// Output
+// ==============================
+
+// label is the single character used for a G in the timeline.
+func label(gg *g) byte {
+	const labels = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+	return labels[gg.id%len(labels)]
+}
+
+func names(gs []*g) string {
+	var parts []string
+	for _, gg := range gs {
+		parts = append(parts, gg.name)
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+// Trace returns the step-by-step event log.
+func (r *Result) Trace() string {
+	var b strings.Builder
+	for _, e := range r.Events {
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// Timeline returns an ASCII chart with one row per P (what it ran each tick)
+// and one row per M that ever blocked in a syscall.
+func (r *Result) Timeline() string {
+	var b strings.Builder
+	b.WriteString("tick  ")
+	for t := 0; t < r.Stats.Ticks; t++ {
+		b.WriteByte("0123456789"[t%10])
+	}
+	b.WriteByte('\n')
+	for i, row := range r.timeline {
+		fmt.Fprintf(&b, "P%-4d %s\n", i, row)
+	}
+	for _, name := range r.sysOrder {
+		row := r.syscalls[name]
+		if strings.TrimSpace(string(row)) == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%-5s %s  (syscall)\n", name, row)
+	}
+	fmt.Fprintf(&b, "legend: %s, '.' = idle\n", strings.Join(r.names, " "))
+	return b.String()
+}
+
+// Summary returns the run statistics as text.
+func (r *Result) Summary() string {
+	st := r.Stats
+	return fmt.Sprintf("ticks=%d threads=%d steals=%d preemptions=%d handoffs=%d busy-per-P=%v",
+		st.Ticks, st.Threads, st.Steals, st.Preemptions, st.Handoffs, st.Busy)
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// TestWorkStealing spawns eight short goroutines from one goroutine on P0.
+// The other Ps find their local queues empty and steal from P0.
+func TestWorkStealing() {
+	var children []Op
+	for _, name := range []string{"w1", "w2", "w3", "w4", "w5", "w6", "w7", "w8"} {
+		children = append(children, Spawn(name, Compute(3)))
+	}
+	sim := New(Config{Procs: 3})
+	sim.Go(Goroutine{Name: "main", Ops: append(children, Compute(2))})
+	res := sim.Run(100)
+
+	fmt.Print(res.Trace())
+	fmt.Print(res.Timeline())
+	fmt.Println(res.Summary())
+}
+
+// TestSyscallHandoff blocks one goroutine in a long syscall. Its P is handed
+// to a new M so the other goroutines keep running; when the syscall returns,
+// the goroutine has to find a P again.
+func TestSyscallHandoff() {
+	sim := New(Config{Procs: 2})
+	sim.Go(Goroutine{Name: "io", Ops: []Op{Compute(1), Syscall(6), Compute(2)}})
+	sim.Go(Goroutine{Name: "cpu1", Ops: []Op{Compute(5)}})
+	sim.Go(Goroutine{Name: "cpu2", Ops: []Op{Compute(5)}})
+	sim.Go(Goroutine{Name: "cpu3", Start: 2, Ops: []Op{Compute(4)}})
+	res := sim.Run(100)
+
+	fmt.Print(res.Trace())
+	fmt.Print(res.Timeline())
+	fmt.Println(res.Summary())
+}
+
+// TestPreemption runs three CPU-bound goroutines on a single P. Without a
+// time slice the first one would run to completion; with TimeSlice 3 they
+// take turns.
+func TestPreemption() {
+	for _, slice := range []int{0, 3} {
+		sim := New(Config{Procs: 1, TimeSlice: slice})
+		for _, name := range []string{"a", "b", "c"} {
+			sim.Go(Goroutine{Name: name, Ops: []Op{Compute(6)}})
+		}
+		res := sim.Run(100)
+		fmt.Printf("TimeSlice=%d\n", slice)
+		fmt.Print(res.Timeline())
+		fmt.Println(res.Summary())
+	}
+}
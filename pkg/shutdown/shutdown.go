@@ -0,0 +1,358 @@
+// shutdown.go
+//
+// This package coordinates a graceful shutdown: it listens for SIGINT/SIGTERM,
+// cancels a root context, runs cleanup hooks in reverse order with per-hook
+// deadlines, waits for tracked goroutines, and reports whatever failed to stop.
+// A second signal during shutdown exits the program at once.
+
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ==============================
+// Graceful Shutdown
+// ==============================
+//
+// A goroutine that is not told to stop is killed mid-loop when main returns.
+// That is fine for a toy, but a real program has connections to close and
+// buffers to flush. A graceful shutdown has three steps:
+//
+// 1. Tell everyone to stop: cancel a context every goroutine watches.
+// 2. Clean up: run hooks in reverse registration order (last opened, first
+//    closed, just like defer), each with its own deadline so one stuck hook
+//    cannot block the rest.
+// 3. Wait: give tracked goroutines a bounded time to return, then report the
+//    ones that did not, instead of hanging forever.
+//
+// One overall timeout bounds steps 2 and 3 together: a hook's deadline is
+// cut short if the overall deadline comes first, and hooks that have not
+// started by then are skipped. If even that is too slow, a second Ctrl+C
+// exits immediately, which is what users expect from a stuck program.
+
+var (
+	// ErrHookTimeout is reported for a hook that did not return before its deadline.
+	ErrHookTimeout = errors.New("shutdown: hook timed out")
+	// ErrHookSkipped is reported for a hook that was not run because the
+	// overall shutdown timeout had already expired.
+	ErrHookSkipped = errors.New("shutdown: hook skipped, shutdown timed out")
+	// ErrShuttingDown is returned by Go once shutdown has begun.
+	ErrShuttingDown = errors.New("shutdown: already shutting down")
+)
+
+// hook is a registered cleanup function.
+type hook struct {
+	name    string
+	timeout time.Duration
+	fn      func(ctx context.Context) error
+}
+
+// Coordinator owns the root context and everything registered against it.
+// Create it with New.
+type Coordinator struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	hooks   []hook
+	running map[int]string
+	nextID  int
+	closing bool           // set once shutdown starts; guarded by mu
+	wg      sync.WaitGroup // Add is only called under mu while !closing
+	exit    func(code int) // os.Exit; replaced in tests
+
+	once   sync.Once
+	done   chan struct{}
+	report Report
+}
+
+// New returns a coordinator whose root context is derived from parent.
+func New(parent context.Context) *Coordinator {
+	ctx, cancel := context.WithCancel(parent)
+	return &Coordinator{
+		ctx:     ctx,
+		cancel:  cancel,
+		running: make(map[int]string),
+		done:    make(chan struct{}),
+		exit:    os.Exit,
+	}
+}
+
+// Context returns the root context. It is cancelled when shutdown starts.
+func (c *Coordinator) Context() context.Context {
+	return c.ctx
+}
+
+// OnShutdown registers a cleanup hook. Hooks run in reverse registration
+// order; each receives a context that expires after timeout, or earlier if
+// the overall shutdown timeout expires first. Hooks registered after
+// shutdown has begun are not run.
+func (c *Coordinator) OnShutdown(name string, timeout time.Duration, fn func(ctx context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hooks = append(c.hooks, hook{name: name, timeout: timeout, fn: fn})
+}
+
+// Go runs fn in a tracked goroutine. fn must return once ctx is cancelled;
+// goroutines still running when shutdown times out are listed in the report.
+// Once shutdown has begun Go does not start fn and returns ErrShuttingDown:
+// the shutdown may already be waiting for the goroutines it knows about.
+func (c *Coordinator) Go(name string, fn func(ctx context.Context)) error {
+	c.mu.Lock()
+	if c.closing {
+		c.mu.Unlock()
+		return ErrShuttingDown
+	}
+	id := c.nextID
+	c.nextID++
+	c.running[id] = name
+	c.wg.Add(1)
+	c.mu.Unlock()
+
+	go func() {
+		defer c.wg.Done()
+		defer func() {
+			c.mu.Lock()
+			delete(c.running, id)
+			c.mu.Unlock()
+		}()
+		fn(c.ctx)
+	}()
+	return nil
+}
+
+// ListenForSignals starts shutdown when one of the signals arrives
+// (SIGINT and SIGTERM if none are given). timeout bounds the whole shutdown.
+// A second signal before shutdown completes exits the program with status 1.
+// The returned function stops listening.
+func (c *Coordinator) ListenForSignals(timeout time.Duration, signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	quit := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			go c.shutdown(sig, timeout)
+		case <-quit:
+			return
+		}
+		select {
+		case sig := <-ch:
+			fmt.Fprintf(os.Stderr, "shutdown: received %v again, exiting now\n", sig)
+			c.exit(1)
+		case <-c.done:
+		case <-quit:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(quit)
+		})
+	}
+}
+
+// Done is closed once shutdown has completed.
+func (c *Coordinator) Done() <-chan struct{} {
+	return c.done
+}
+
+// Wait blocks until shutdown has completed (usually started by a signal)
+// and returns its report.
+func (c *Coordinator) Wait() Report {
+	<-c.done
+	return c.report
+}
+
+// Shutdown cancels the root context, runs the hooks and waits for tracked
+// goroutines, spending at most timeout on the hooks and the wait together. It is safe to call more
+// than once and from several goroutines; every call returns the same report.
+func (c *Coordinator) Shutdown(timeout time.Duration) Report {
+	c.shutdown(nil, timeout)
+	return c.Wait()
+}
+
+func (c *Coordinator) shutdown(sig os.Signal, timeout time.Duration) {
+	c.once.Do(func() {
+		start := time.Now()
+		overall, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		c.report.Signal = sig
+
+		c.mu.Lock()
+		c.closing = true
+		hooks := append([]hook(nil), c.hooks...)
+		c.mu.Unlock()
+		c.cancel()
+
+		for i := len(hooks) - 1; i >= 0; i-- {
+			err := ErrHookSkipped
+			if overall.Err() == nil {
+				err = runHook(overall, hooks[i])
+			}
+			if err != nil {
+				c.report.Failed = append(c.report.Failed, HookError{Hook: hooks[i].name, Err: err})
+			}
+		}
+
+		deadline, _ := overall.Deadline()
+
+		c.report.Stuck = c.waitGoroutines(time.Until(deadline))
+		c.report.Duration = time.Since(start)
+		close(c.done)
+	})
+}
+
+// runHook runs h with its own deadline, capped by parent's. A hook that
+// ignores its context is abandoned (left running) once the deadline passes.
+func runHook(parent context.Context, h hook) (err error) {
+	ctx, cancel := context.WithTimeout(parent, h.timeout)
+	defer cancel()
+
+	result := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				result <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		result <- h.fn(ctx)
+	}()
+
+	select {
+	case err := <-result:
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrHookTimeout
+		}
+		return err
+	case <-ctx.Done():
+		return ErrHookTimeout
+	}
+}
+
+// waitGoroutines waits up to timeout for tracked goroutines and returns the
+// names of those still running.
+func (c *Coordinator) waitGoroutines(timeout time.Duration) []string {
+	finished := make(chan struct{})
+	go func() {
+		c.wg.Wait()
+		close(finished)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-finished:
+		return nil
+	case <-timer.C:
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var stuck []string
+	for _, name := range c.running {
+		stuck = append(stuck, name)
+	}
+	sort.Strings(stuck)
+	return stuck
+}
+
+// ==============================
+// Report
+// ==============================
+
+// HookError is a cleanup hook that failed or timed out.
+type HookError struct {
+	Hook string
+	Err  error
+}
+
+// Report describes how the shutdown went.
+type Report struct {
+	Signal   os.Signal // nil when Shutdown was called directly
+	Failed   []HookError
+	Stuck    []string // tracked goroutines that did not return in time
+	Duration time.Duration
+}
+
+// Err returns nil if every hook succeeded and every goroutine stopped.
+func (r Report) Err() error {
+	if len(r.Failed) == 0 && len(r.Stuck) == 0 {
+		return nil
+	}
+	var parts []string
+	for _, f := range r.Failed {
+		parts = append(parts, fmt.Sprintf("hook %q: %v", f.Hook, f.Err))
+	}
+	if len(r.Stuck) > 0 {
+		parts = append(parts, fmt.Sprintf("goroutines still running: %s", strings.Join(r.Stuck, ", ")))
+	}
+	return errors.New("shutdown: " + strings.Join(parts, "; "))
+}
+
+func (r Report) String() string {
+	trigger := "Shutdown called"
+	if r.Signal != nil {
+		trigger = "received " + r.Signal.String()
+	}
+	if err := r.Err(); err != nil {
+		return fmt.Sprintf("%s; finished in %v with problems: %v", trigger, r.Duration.Round(time.Millisecond), err)
+	}
+	return fmt.Sprintf("%s; clean shutdown in %v", trigger, r.Duration.Round(time.Millisecond))
+}
+
+// ==============================
+// Example
+// ==============================
+
+// TestShutdown registers a well-behaved worker, a worker that ignores
+// cancellation, and two hooks, one of which is too slow. The report names
+// both problems instead of hanging.
+func TestShutdown() {
+	c := New(context.Background())
+
+	c.Go("ticker", func(ctx context.Context) {
+		for {
+			select {
+			case <-ctx.Done():
+				fmt.Println("ticker: stopping")
+				return
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	})
+	c.Go("stubborn", func(ctx context.Context) {
+		time.Sleep(time.Second) // never looks at ctx
+	})
+
+	c.OnShutdown("close database", 100*time.Millisecond, func(ctx context.Context) error {
+		fmt.Println("closing database")
+		return nil
+	})
+	c.OnShutdown("flush cache", 100*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done() // takes longer than its deadline
+		return ctx.Err()
+	})
+
+	time.Sleep(120 * time.Millisecond)
+	fmt.Println(c.Shutdown(300 * time.Millisecond))
+	// ticker: stopping
+	// closing database      <- runs after "flush cache": reverse order
+	// Shutdown called; finished in 300ms with problems: shutdown: hook "flush cache":
+	// shutdown: hook timed out; goroutines still running: stubborn
+}
@@ -0,0 +1,88 @@
+// shutdown_test.go
+//
+// Tests for the shutdown coordinator.
+
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestGoAfterShutdownIsRefused(t *testing.T) {
+	c := New(context.Background())
+	c.Shutdown(time.Second)
+
+	ran := make(chan struct{}, 1)
+	err := c.Go("late", func(ctx context.Context) { ran <- struct{}{} })
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Fatalf("Go after shutdown = %v, want ErrShuttingDown", err)
+	}
+	select {
+	case <-ran:
+		t.Fatal("Go started fn after shutdown")
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestOverallTimeoutBoundsHooks(t *testing.T) {
+	c := New(context.Background())
+	ran := false
+	c.OnShutdown("never reached", time.Second, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+	c.OnShutdown("slow", time.Second, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	start := time.Now()
+	r := c.Shutdown(50 * time.Millisecond)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("Shutdown took %v, want about 50ms", elapsed)
+	}
+	if ran {
+		t.Error("a hook ran after the overall timeout expired")
+	}
+	if len(r.Failed) != 2 || !errors.Is(r.Failed[0].Err, ErrHookTimeout) || !errors.Is(r.Failed[1].Err, ErrHookSkipped) {
+		t.Fatalf("Failed = %v, want [slow: timeout, never reached: skipped]", r.Failed)
+	}
+}
+
+func TestSecondSignalForcesExit(t *testing.T) {
+	c := New(context.Background())
+	exited := make(chan int, 1)
+	c.exit = func(code int) { exited <- code }
+
+	hookStarted := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	c.OnShutdown("stuck", time.Minute, func(ctx context.Context) error {
+		close(hookStarted)
+		<-release
+		return nil
+	})
+
+	stop := c.ListenForSignals(time.Minute, syscall.SIGUSR1)
+	defer stop()
+
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case <-hookStarted:
+	case <-time.After(time.Second):
+		t.Fatal("first signal did not start shutdown")
+	}
+	syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+	select {
+	case code := <-exited:
+		if code != 1 {
+			t.Fatalf("exit code = %d, want 1", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second signal did not force exit")
+	}
+}
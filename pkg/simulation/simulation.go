@@ -0,0 +1,475 @@
+// simulation.go
+//
+// This package is a discrete-event simulator: a virtual clock, a priority
+// queue of timestamped events, processes written as ordinary goroutines that
+// Wait on simulated time, and resources with limited capacity. A coffee shop
+// simulation shows how long customers wait, without sleeping for real.
+
+package simulation
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// ==============================
+// Discrete-Event Simulation
+// ==============================
+//
+// A discrete-event simulation skips the time in which nothing happens. It
+// keeps a queue of future events ordered by time, and repeatedly takes the
+// earliest one, moves the clock to it, and runs it. A day in a coffee shop
+// takes milliseconds.
+//
+// Writing a customer as a chain of callbacks ("when the barista is free,
+// schedule the end of the order, which schedules...") gets unreadable fast.
+// Here each customer is a process: a goroutine that reads top to bottom,
+//
+//     p.Wait(30 * time.Second)   // walk in
+//     barista.Acquire(p)         // queue for a barista
+//     p.Wait(2 * time.Minute)    // make the drink
+//     barista.Release()
+//
+// but runs in simulated time. Only one goroutine runs at a time: the
+// scheduler resumes a process and waits until it blocks again in Wait or
+// Acquire, or finishes. That hand-off makes the simulation deterministic
+// (the same seed gives the same result) and means processes need no locks.
+
+// event is something that happens at a point in simulated time. seq breaks
+// ties, so events at the same time run in the order they were scheduled.
+type event struct {
+	at  time.Duration
+	seq int
+	fn  func()
+}
+
+type eventQueue []*event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].at != q[j].at {
+		return q[i].at < q[j].at
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x interface{}) { *q = append(*q, x.(*event)) }
+func (q *eventQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+	return e
+}
+
+// Sim is a simulation. Create it with New.
+type Sim struct {
+	now    time.Duration
+	events eventQueue
+	seq    int
+	yield  chan struct{}  // a process has blocked or finished
+	procs  map[*Proc]bool // processes that have not finished
+	Rand   *rand.Rand     // for random durations; only use it from processes and events
+}
+
+// New returns a simulation at time 0.
+func New(seed int64) *Sim {
+	return &Sim{
+		yield: make(chan struct{}),
+		procs: make(map[*Proc]bool),
+		Rand:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Now returns the simulated time since the start.
+func (s *Sim) Now() time.Duration {
+	return s.now
+}
+
+// Schedule runs fn after d of simulated time.
+func (s *Sim) Schedule(d time.Duration, fn func()) {
+	if d < 0 {
+		d = 0
+	}
+	s.seq++
+	heap.Push(&s.events, &event{at: s.now + d, seq: s.seq, fn: fn})
+}
+
+// Run runs events until none are left or the next one is after until. The
+// clock stops at until, or at the last event if they ran out first.
+// Processes still waiting are stopped; see Stop.
+func (s *Sim) Run(until time.Duration) {
+	for len(s.events) > 0 && s.events[0].at <= until {
+		e := heap.Pop(&s.events).(*event)
+		s.now = e.at
+		e.fn()
+	}
+	if len(s.events) > 0 {
+		s.now = until
+	}
+	s.Stop()
+}
+
+// Stop ends every process that is still waiting, so no goroutine is left
+// behind. Their deferred calls run, but they must not Wait or Acquire.
+func (s *Sim) Stop() {
+	for p := range s.procs {
+		close(p.wake)
+		<-s.yield
+	}
+	s.events = nil
+}
+
+// Exp returns a random duration with an exponential distribution, the usual
+// model for the time between independent arrivals.
+func (s *Sim) Exp(mean time.Duration) time.Duration {
+	return time.Duration(s.Rand.ExpFloat64() * float64(mean))
+}
+
+// Uniform returns a random duration between min and max.
+func (s *Sim) Uniform(min, max time.Duration) time.Duration {
+	if max <= min {
+		return min
+	}
+	return min + time.Duration(s.Rand.Int63n(int64(max-min)))
+}
+
+// ==============================
+// Processes
+// ==============================
+
+// Proc is a running process.
+type Proc struct {
+	Name string
+	sim  *Sim
+	wake chan struct{} // the scheduler resumes the process; closed to stop it
+}
+
+// Process starts fn as a new process at the current simulated time.
+func (s *Sim) Process(name string, fn func(p *Proc)) {
+	p := &Proc{Name: name, sim: s, wake: make(chan struct{})}
+	s.Schedule(0, func() {
+		s.procs[p] = true
+		go func() {
+			defer func() {
+				delete(s.procs, p)
+				s.yield <- struct{}{}
+			}()
+			p.park()
+			fn(p)
+		}()
+		s.resume(p)
+	})
+}
+
+// resume hands control to p and waits for it to hand it back.
+// It runs on the scheduler.
+func (s *Sim) resume(p *Proc) {
+	p.wake <- struct{}{}
+	<-s.yield
+}
+
+// park hands control back to the scheduler and waits to be resumed. It runs
+// on the process.
+func (p *Proc) park() {
+	if _, ok := <-p.wake; !ok {
+		runtime.Goexit() // stopped by Sim.Stop
+	}
+}
+
+// block is park for a process that has already been started: it first tells
+// the scheduler that it is blocked.
+func (p *Proc) block() {
+	p.sim.yield <- struct{}{}
+	p.park()
+}
+
+// Sim returns the simulation p runs in.
+func (p *Proc) Sim() *Sim {
+	return p.sim
+}
+
+// Now returns the simulated time.
+func (p *Proc) Now() time.Duration {
+	return p.sim.now
+}
+
+// Wait blocks the process for d of simulated time.
+func (p *Proc) Wait(d time.Duration) {
+	p.sim.Schedule(d, func() { p.sim.resume(p) })
+	p.block()
+}
+
+// ==============================
+// Resources
+// ==============================
+
+// Resource is something processes queue for, like a barista or a checkout,
+// with room for Capacity users at once. Waiting processes are served first
+// come, first served.
+type Resource struct {
+	Name     string
+	Capacity int
+	sim      *Sim
+	inUse    int
+	queue    []*Proc
+
+	// Time-weighted statistics.
+	last      time.Duration
+	busyArea  float64 // integral of inUse over time
+	queueArea float64 // integral of len(queue) over time
+	maxQueue  int
+}
+
+// NewResource returns a resource with room for capacity users.
+func (s *Sim) NewResource(name string, capacity int) *Resource {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &Resource{Name: name, Capacity: capacity, sim: s}
+}
+
+// update accumulates the statistics up to now.
+func (r *Resource) update() {
+	dt := float64(r.sim.now - r.last)
+	r.busyArea += float64(r.inUse) * dt
+	r.queueArea += float64(len(r.queue)) * dt
+	r.last = r.sim.now
+}
+
+// Acquire waits until the resource has room and takes a place.
+func (r *Resource) Acquire(p *Proc) {
+	r.update()
+	if r.inUse < r.Capacity {
+		r.inUse++
+		return
+	}
+	r.queue = append(r.queue, p)
+	if len(r.queue) > r.maxQueue {
+		r.maxQueue = len(r.queue)
+	}
+	p.block() // Release hands its place over and resumes us
+}
+
+// Release gives a place back. If a process is waiting, the place goes
+// straight to it.
+func (r *Resource) Release() {
+	r.update()
+	if len(r.queue) == 0 {
+		r.inUse--
+		return
+	}
+	next := r.queue[0]
+	r.queue[0] = nil
+	r.queue = r.queue[1:]
+	r.sim.Schedule(0, func() { r.sim.resume(next) })
+}
+
+// Utilization returns the average fraction of the capacity in use so far.
+func (r *Resource) Utilization() float64 {
+	r.update()
+	if r.sim.now == 0 {
+		return 0
+	}
+	return r.busyArea / float64(r.sim.now) / float64(r.Capacity)
+}
+
+// MeanQueue returns the average number of waiting processes so far.
+func (r *Resource) MeanQueue() float64 {
+	r.update()
+	if r.sim.now == 0 {
+		return 0
+	}
+	return r.queueArea / float64(r.sim.now)
+}
+
+// MaxQueue returns the longest the queue has been.
+func (r *Resource) MaxQueue() int {
+	return r.maxQueue
+}
+
+// ==============================
+// Statistics
+// ==============================
+
+// Tally collects durations, such as waiting times.
+type Tally struct {
+	values []time.Duration
+	sum    time.Duration
+	sorted bool
+}
+
+// Add records d.
+func (t *Tally) Add(d time.Duration) {
+	t.values = append(t.values, d)
+	t.sum += d
+	t.sorted = false
+}
+
+// Count returns the number of values.
+func (t *Tally) Count() int {
+	return len(t.values)
+}
+
+// Mean returns the average value.
+func (t *Tally) Mean() time.Duration {
+	if len(t.values) == 0 {
+		return 0
+	}
+	return t.sum / time.Duration(len(t.values))
+}
+
+// Percentile returns the value below which a fraction q of the values fall.
+// q is clamped to [0, 1]: 0 gives the minimum, 1 the maximum.
+func (t *Tally) Percentile(q float64) time.Duration {
+	if len(t.values) == 0 {
+		return 0
+	}
+	if q < 0 || math.IsNaN(q) {
+		q = 0
+	} else if q > 1 {
+		q = 1
+	}
+	if !t.sorted {
+		sort.Slice(t.values, func(i, j int) bool { return t.values[i] < t.values[j] })
+		t.sorted = true
+	}
+	return t.values[int(q*float64(len(t.values)-1))]
+}
+
+// ==============================
+// Example: A Coffee Shop
+// ==============================
+
+// ShopConfig describes a coffee shop.
+type ShopConfig struct {
+	Baristas    int
+	Open        time.Duration // how long the doors are open
+	Arrivals    time.Duration // mean time between customers
+	OrderMin    time.Duration // time at the register
+	OrderMax    time.Duration
+	DrinkMean   time.Duration // mean time to make a drink
+	Seed        int64
+	TraceFirstN int // print the first N customers' steps
+}
+
+// ShopReport is what one simulated day measured.
+type ShopReport struct {
+	Served              int
+	Wait                Tally // time in line, at the register and for a barista
+	Total               Tally // from arriving to leaving with a drink
+	RegisterUse, BarUse float64
+	MeanLine, MaxLine   float64 // people waiting for a barista
+	Closed              time.Duration
+}
+
+// SimulateShop runs one day: customers arrive at random, order at a single
+// register, then wait for one of the baristas to make their drink.
+func SimulateShop(cfg ShopConfig) ShopReport {
+	s := New(cfg.Seed)
+	register := s.NewResource("register", 1)
+	baristas := s.NewResource("baristas", cfg.Baristas)
+	var r ShopReport
+
+	customer := func(p *Proc, traced bool) {
+		trace := func(format string, args ...interface{}) {
+			if traced {
+				fmt.Printf("  %8v  %s %s\n", p.Now().Round(time.Second), p.Name, fmt.Sprintf(format, args...))
+			}
+		}
+		arrived := p.Now()
+		trace("arrives")
+		register.Acquire(p)
+		atRegister := p.Now()
+		p.Wait(s.Uniform(cfg.OrderMin, cfg.OrderMax))
+		register.Release()
+		trace("has ordered")
+
+		ordered := p.Now()
+		baristas.Acquire(p)
+		trace("gets a barista")
+		r.Wait.Add(atRegister - arrived + p.Now() - ordered)
+		p.Wait(s.Exp(cfg.DrinkMean))
+		baristas.Release()
+		r.Total.Add(p.Now() - arrived)
+		r.Served++
+		trace("leaves after %v", (p.Now() - arrived).Round(time.Second))
+	}
+
+	s.Process("door", func(p *Proc) {
+		for i := 1; p.Now() < cfg.Open; i++ {
+			traced := i <= cfg.TraceFirstN
+			s.Process(fmt.Sprintf("customer %d", i), func(p *Proc) { customer(p, traced) })
+			p.Wait(s.Exp(cfg.Arrivals))
+		}
+	})
+	// Run long enough after closing for everyone inside to be served.
+	s.Run(cfg.Open + 2*time.Hour)
+
+	r.RegisterUse, r.BarUse = register.Utilization(), baristas.Utilization()
+	r.MeanLine, r.MaxLine = baristas.MeanQueue(), float64(baristas.MaxQueue())
+	r.Closed = s.Now()
+	return r
+}
+
+// TestCoffeeShop simulates an eight-hour day with two and with three
+// baristas and compares how long customers wait.
+func TestCoffeeShop() {
+	start := time.Now()
+	cfg := ShopConfig{
+		Open:        8 * time.Hour,
+		Arrivals:    time.Minute,
+		OrderMin:    20 * time.Second,
+		OrderMax:    50 * time.Second,
+		DrinkMean:   100 * time.Second,
+		Seed:        1,
+		TraceFirstN: 3,
+	}
+	for _, n := range []int{2, 3} {
+		cfg.Baristas = n
+		fmt.Printf("%d baristas:\n", n)
+		r := SimulateShop(cfg)
+		fmt.Printf("  served %d, register busy %.0f%%, baristas busy %.0f%%\n",
+			r.Served, r.RegisterUse*100, r.BarUse*100)
+		fmt.Printf("  time in line:       mean %v, p90 %v, max %v\n",
+			r.Wait.Mean().Round(time.Second), r.Wait.Percentile(0.9).Round(time.Second), r.Wait.Percentile(1).Round(time.Second))
+		fmt.Printf("  time in shop:       mean %v, p90 %v\n",
+			r.Total.Mean().Round(time.Second), r.Total.Percentile(0.9).Round(time.Second))
+		fmt.Printf("  line for baristas:  mean %.1f, max %.0f\n", r.MeanLine, r.MaxLine)
+		cfg.TraceFirstN = 0
+	}
+	fmt.Printf("simulated two 8-hour days in %v\n", time.Since(start).Round(time.Millisecond))
+	// 2 baristas:
+	//         0s  customer 1 arrives
+	//        33s  customer 1 has ordered
+	//        33s  customer 1 gets a barista
+	//        35s  customer 2 arrives
+	//       1m2s  customer 2 has ordered
+	//       1m2s  customer 2 gets a barista
+	//      1m16s  customer 3 arrives
+	//      1m24s  customer 2 leaves after 49s
+	//      1m43s  customer 3 has ordered
+	//      1m43s  customer 3 gets a barista
+	//      2m36s  customer 1 leaves after 2m36s
+	//      3m18s  customer 3 leaves after 2m2s
+	//   served 486, register busy 59%, baristas busy 77%
+	//   time in line:       mean 2m15s, p90 6m26s, max 12m6s
+	//   time in shop:       mean 4m23s, p90 9m10s
+	//   line for baristas:  mean 1.7, max 11
+	// 3 baristas:
+	//   served 489, register busy 60%, baristas busy 55%
+	//   time in line:       mean 58s, p90 2m33s, max 8m51s
+	//   time in shop:       mean 3m12s, p90 6m14s
+	//   line for baristas:  mean 0.4, max 7
+	// simulated two 8-hour days in 8ms
+	//
+	// The output is the same on every run: only one process runs at a time,
+	// and all randomness comes from the seed. Going from 77% to 55% busy
+	// more than halves the time in line; queues grow steeply as a resource
+	// gets close to fully used.
+}
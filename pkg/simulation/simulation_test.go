@@ -0,0 +1,87 @@
+// simulation_test.go
+//
+// Tests for the discrete-event simulator: determinism, first-come first-served
+// resources and the statistics.
+
+package simulation
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSimulateShopIsDeterministic(t *testing.T) {
+	cfg := ShopConfig{
+		Baristas:  2,
+		Open:      2 * time.Hour,
+		Arrivals:  time.Minute,
+		OrderMin:  20 * time.Second,
+		OrderMax:  50 * time.Second,
+		DrinkMean: 100 * time.Second,
+		Seed:      7,
+	}
+	first, second := SimulateShop(cfg), SimulateShop(cfg)
+	if first.Served == 0 {
+		t.Fatal("nobody was served")
+	}
+	if !reflect.DeepEqual(first, second) {
+		t.Fatalf("two runs with seed %d differ:\n%+v\n%+v", cfg.Seed, first, second)
+	}
+}
+
+func TestResourceServesInArrivalOrder(t *testing.T) {
+	s := New(1)
+	r := s.NewResource("counter", 1)
+	var served []string
+
+	s.Process("holder", func(p *Proc) {
+		r.Acquire(p)
+		p.Wait(10 * time.Second)
+		r.Release()
+	})
+	// Started in one order, arriving in the reverse one: w4 at 1s, w1 at 4s.
+	for i := 1; i <= 4; i++ {
+		name, arrive := fmt.Sprintf("w%d", i), time.Duration(5-i)*time.Second
+		s.Process(name, func(p *Proc) {
+			p.Wait(arrive)
+			r.Acquire(p)
+			served = append(served, fmt.Sprintf("%s@%v", name, p.Now()))
+			p.Wait(time.Second)
+			r.Release()
+		})
+	}
+	s.Run(time.Minute)
+
+	want := []string{"w4@10s", "w3@11s", "w2@12s", "w1@13s"}
+	if !reflect.DeepEqual(served, want) {
+		t.Fatalf("served %v, want %v", served, want)
+	}
+	if n := r.MaxQueue(); n != 4 {
+		t.Fatalf("MaxQueue = %d, want 4", n)
+	}
+}
+
+func TestTallyPercentileClampsQ(t *testing.T) {
+	var tally Tally
+	for i := 1; i <= 5; i++ {
+		tally.Add(time.Duration(i) * time.Second)
+	}
+	for _, c := range []struct {
+		q    float64
+		want time.Duration
+	}{
+		{-1, time.Second},
+		{0, time.Second},
+		{0.5, 3 * time.Second},
+		{1, 5 * time.Second},
+		{2, 5 * time.Second},
+		{math.NaN(), time.Second},
+	} {
+		if got := tally.Percentile(c.q); got != c.want {
+			t.Errorf("Percentile(%v) = %v, want %v", c.q, got, c.want)
+		}
+	}
+}
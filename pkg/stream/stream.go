@@ -0,0 +1,416 @@
+// stream.go
+//
+// This package aggregates a stream of timestamped events arriving on a
+// channel into tumbling, sliding and session windows per key, with
+// allowed lateness for out-of-order events and an injectable clock.
+
+package stream
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"Golan-Concepts/pkg/clock"
+)
+
+// ==============================
+// Windowed Aggregation
+// ==============================
+//
+// A stream never ends, so "the sum of all values" is never ready. Windows
+// cut it into finite pieces by time and report one aggregate per piece:
+//
+//     Tumbling(1m):           |---- w1 ----|---- w2 ----|---- w3 ----|
+//                             fixed size, no overlap: each event is in one window
+//
+//     Sliding(1m, 30s):       |---- w1 ----|
+//                                   |---- w2 ----|
+//                                         |---- w3 ----|
+//                             fixed size, overlapping: an event is in size/slide windows
+//
+//     Session(30s gap):       |-- a a a --|        |- a -|    |-- a a --|
+//                             sized by activity: a window ends after a 30s silence
+//
+// Each event carries its own time (event time), which is when it happened,
+// not when it arrived. Events can arrive out of order: a phone that was
+// offline uploads its events late. A window is therefore kept open for
+// AllowedLateness after its end, measured on the clock, and emitted once
+// when that runs out. An event for a window that was already emitted is late
+// and goes to OnLate instead.
+//
+// The aggregator is one goroutine that owns all state, reading events and
+// clock ticks with select, so no locking is needed.
+
+// Event is one observation.
+type Event struct {
+	Key   string
+	Value float64
+	Time  time.Time // when the event happened
+}
+
+// Aggregate summarizes the values in a window.
+type Aggregate struct {
+	Count    int
+	Sum      float64
+	Min, Max float64
+}
+
+func (a *Aggregate) add(v float64) {
+	if a.Count == 0 {
+		a.Min, a.Max = v, v
+	}
+	a.Count++
+	a.Sum += v
+	a.Min = math.Min(a.Min, v)
+	a.Max = math.Max(a.Max, v)
+}
+
+func (a *Aggregate) merge(b Aggregate) {
+	if b.Count == 0 {
+		return
+	}
+	if a.Count == 0 {
+		*a = b
+		return
+	}
+	a.Count += b.Count
+	a.Sum += b.Sum
+	a.Min = math.Min(a.Min, b.Min)
+	a.Max = math.Max(a.Max, b.Max)
+}
+
+// Mean returns Sum / Count, or 0 for an empty aggregate.
+func (a Aggregate) Mean() float64 {
+	if a.Count == 0 {
+		return 0
+	}
+	return a.Sum / float64(a.Count)
+}
+
+// Result is the aggregate of one key in one window, emitted when the window closes.
+type Result struct {
+	Key        string
+	Start, End time.Time // the window is [Start, End)
+	Aggregate
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s [%s, %s) count=%d sum=%g min=%g max=%g",
+		r.Key, r.Start.Format("15:04:05"), r.End.Format("15:04:05"), r.Count, r.Sum, r.Min, r.Max)
+}
+
+// ==============================
+// Window Kinds
+// ==============================
+
+// Windows describes how events are assigned to windows. Use Tumbling,
+// Sliding or Session; the zero value is not usable.
+type Windows struct {
+	size, slide, gap time.Duration
+}
+
+// Tumbling returns fixed-size, non-overlapping windows aligned to size.
+// It panics if size is not positive.
+func Tumbling(size time.Duration) Windows {
+	if size <= 0 {
+		panic(fmt.Sprintf("stream: Tumbling(%v): size must be positive", size))
+	}
+	return Windows{size: size, slide: size}
+}
+
+// Sliding returns windows of the given size starting every slide. It panics
+// unless 0 < slide <= size: a zero slide would put every event in infinitely
+// many windows, and a slide larger than size would leave gaps between
+// windows whose events would all be dropped as late.
+func Sliding(size, slide time.Duration) Windows {
+	if size <= 0 || slide <= 0 || slide > size {
+		panic(fmt.Sprintf("stream: Sliding(%v, %v): need 0 < slide <= size", size, slide))
+	}
+	return Windows{size: size, slide: slide}
+}
+
+// Session returns per-key windows that close after gap without events.
+// It panics if gap is not positive.
+func Session(gap time.Duration) Windows {
+	if gap <= 0 {
+		panic(fmt.Sprintf("stream: Session(%v): gap must be positive", gap))
+	}
+	return Windows{gap: gap}
+}
+
+func (w Windows) String() string {
+	switch {
+	case w.gap > 0:
+		return fmt.Sprintf("session(%v)", w.gap)
+	case w.size == w.slide:
+		return fmt.Sprintf("tumbling(%v)", w.size)
+	default:
+		return fmt.Sprintf("sliding(%v, %v)", w.size, w.slide)
+	}
+}
+
+// span is a window's extent, [start, end).
+type span struct {
+	start, end time.Time
+}
+
+// assign returns the windows t belongs to. A session event starts out in a
+// window of its own, which is then merged with overlapping sessions.
+func (w Windows) assign(t time.Time) []span {
+	if w.gap > 0 {
+		return []span{{t, t.Add(w.gap)}}
+	}
+	var spans []span
+	for start := t.Truncate(w.slide); t.Before(start.Add(w.size)); start = start.Add(-w.slide) {
+		spans = append(spans, span{start, start.Add(w.size)})
+	}
+	return spans
+}
+
+// ==============================
+// Aggregator
+// ==============================
+
+// Options configures Windowed.
+type Options struct {
+	Windows Windows
+	// AllowedLateness keeps windows open this long after their end.
+	AllowedLateness time.Duration
+	// Clock decides when windows close. Defaults to clock.Real.
+	Clock clock.Clock
+	// Tick is how often the clock is sampled to close windows. Defaults to
+	// one second. Windows close up to one Tick after their deadline.
+	Tick time.Duration
+	// OnLate is called for events whose windows were all emitted already.
+	OnLate func(Event)
+}
+
+// window is an open window of one key.
+type window struct {
+	span
+	agg Aggregate
+}
+
+type aggregator struct {
+	opts Options
+	now  time.Time // the clock, sampled at the last tick
+	open map[string][]*window
+	out  chan<- Result
+}
+
+// Windowed reads events from in and emits a Result for every key and window
+// once the window has closed. When in is closed, all open windows are emitted
+// and the result channel is closed. It panics if opts.Windows was not made
+// by Tumbling, Sliding or Session.
+func Windowed(in <-chan Event, opts Options) <-chan Result {
+	if opts.Windows == (Windows{}) {
+		panic("stream: Options.Windows is not set; use Tumbling, Sliding or Session")
+	}
+	if opts.Clock == nil {
+		opts.Clock = clock.Real
+	}
+	if opts.Tick <= 0 {
+		opts.Tick = time.Second
+	}
+	out := make(chan Result)
+	a := &aggregator{opts: opts, now: opts.Clock.Now(), open: make(map[string][]*window), out: out}
+	// Start the ticker before returning, so that a fake clock advanced
+	// right after this call already drives it.
+	go a.run(in, opts.Clock.NewTicker(opts.Tick))
+	return out
+}
+
+// run owns all aggregator state. The clock is only read when a tick is
+// handled, and pending ticks are handled before the next event. With a fake
+// clock, an event sent after Advance therefore always sees the advanced time.
+func (a *aggregator) run(in <-chan Event, ticker clock.Ticker) {
+	defer close(a.out)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			a.tick()
+			continue
+		default:
+		}
+		select {
+		case e, ok := <-in:
+			if !ok {
+				a.emit(func(*window) bool { return true })
+				return
+			}
+			a.add(e)
+		case <-ticker.C():
+			a.tick()
+		}
+	}
+}
+
+// tick emits the windows that closed since the last tick.
+func (a *aggregator) tick() {
+	a.now = a.opts.Clock.Now()
+	a.emit(func(w *window) bool { return a.closed(w.span) })
+}
+
+// closed reports whether s has run past its allowed lateness.
+func (a *aggregator) closed(s span) bool {
+	return !a.now.Before(s.end.Add(a.opts.AllowedLateness))
+}
+
+func (a *aggregator) add(e Event) {
+	accepted := false
+	for _, s := range a.opts.Windows.assign(e.Time) {
+		if a.closed(s) {
+			continue
+		}
+		accepted = true
+		w := a.window(e.Key, s)
+		w.agg.add(e.Value)
+	}
+	if !accepted && a.opts.OnLate != nil {
+		a.opts.OnLate(e)
+	}
+}
+
+// window returns the open window of key for s, creating it if needed.
+// Sessions are merged with every open session of the key they overlap.
+func (a *aggregator) window(key string, s span) *window {
+	windows := a.open[key]
+	if a.opts.Windows.gap == 0 {
+		for _, w := range windows {
+			if w.start.Equal(s.start) {
+				return w
+			}
+		}
+		w := &window{span: s}
+		a.open[key] = append(windows, w)
+		return w
+	}
+
+	merged := &window{span: s}
+	var rest []*window
+	for _, w := range windows {
+		// Open sessions never overlap each other, so one pass is enough.
+		if w.start.Before(merged.end) && merged.start.Before(w.end) {
+			if w.start.Before(merged.start) {
+				merged.start = w.start
+			}
+			if w.end.After(merged.end) {
+				merged.end = w.end
+			}
+			merged.agg.merge(w.agg)
+			continue
+		}
+		rest = append(rest, w)
+	}
+	a.open[key] = append(rest, merged)
+	return merged
+}
+
+// emit sends and removes every open window for which done returns true,
+// ordered by end time and key.
+func (a *aggregator) emit(done func(*window) bool) {
+	var results []Result
+	for key, windows := range a.open {
+		var keep []*window
+		for _, w := range windows {
+			if done(w) {
+				results = append(results, Result{Key: key, Start: w.start, End: w.end, Aggregate: w.agg})
+				continue
+			}
+			keep = append(keep, w)
+		}
+		if len(keep) == 0 {
+			delete(a.open, key)
+		} else {
+			a.open[key] = keep
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		if !results[i].End.Equal(results[j].End) {
+			return results[i].End.Before(results[j].End)
+		}
+		if results[i].Key != results[j].Key {
+			return results[i].Key < results[j].Key
+		}
+		return results[i].Start.Before(results[j].Start)
+	})
+	for _, r := range results {
+		a.out <- r
+	}
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// arrival is an event together with the moment it reaches the aggregator,
+// as an offset from the start of the demo.
+type arrival struct {
+	at    time.Duration
+	event Event
+}
+
+// replay is a generator (see concurrency.Generator) that moves the fake clock
+// to each arrival time before sending the event, then lets the clock run on
+// until every window has closed.
+func replay(fake *clock.Fake, start time.Time, arrivals []arrival) <-chan Event {
+	c := make(chan Event)
+	go func() {
+		defer close(c)
+		for _, a := range arrivals {
+			fake.Set(start.Add(a.at))
+			c <- a.event
+		}
+		fake.Advance(5 * time.Minute)
+	}()
+	return c
+}
+
+// TestWindows runs the same events through tumbling, sliding and session
+// windows, on a fake clock so the output is always the same.
+func TestWindows() {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+	arrivals := []arrival{
+		{5 * time.Second, Event{"cpu", 40, at(5 * time.Second)}},
+		{20 * time.Second, Event{"cpu", 60, at(20 * time.Second)}},
+		{30 * time.Second, Event{"mem", 512, at(30 * time.Second)}},
+		{70 * time.Second, Event{"cpu", 90, at(70 * time.Second)}},
+		{75 * time.Second, Event{"cpu", 10, at(55 * time.Second)}},   // 20s late: within allowed lateness
+		{100 * time.Second, Event{"mem", 128, at(45 * time.Second)}}, // 55s late: its windows are gone
+		{150 * time.Second, Event{"cpu", 30, at(150 * time.Second)}},
+	}
+
+	for _, windows := range []Windows{Tumbling(time.Minute), Sliding(time.Minute, 30*time.Second), Session(30 * time.Second)} {
+		fmt.Println(windows)
+		fake := clock.NewFake(start)
+		results := Windowed(replay(fake, start, arrivals), Options{
+			Windows:         windows,
+			AllowedLateness: 30 * time.Second,
+			Clock:           fake,
+			OnLate:          func(e Event) { fmt.Printf("  late: %s %g at %s\n", e.Key, e.Value, e.Time.Format("15:04:05")) },
+		})
+		for r := range results {
+			fmt.Println(" ", r)
+		}
+	}
+	// tumbling(1m0s)
+	//   cpu [12:00:00, 12:01:00) count=3 sum=110 min=10 max=60   <- includes the late 10
+	//   mem [12:00:00, 12:01:00) count=1 sum=512 min=512 max=512
+	//   late: mem 128 at 12:00:45
+	//   cpu [12:01:00, 12:02:00) count=1 sum=90 min=90 max=90
+	//   cpu [12:02:00, 12:03:00) count=1 sum=30 min=30 max=30
+	// sliding(1m0s, 30s)
+	//   cpu [11:59:30, 12:00:30) count=2 sum=100 min=40 max=60
+	//   cpu [12:00:00, 12:01:00) count=3 sum=110 min=10 max=60
+	//   ...                                                       <- every event is in two windows
+	// session(30s)
+	//   cpu [12:00:05, 12:00:50) count=2 sum=100 min=40 max=60
+	//   mem [12:00:30, 12:01:00) count=1 sum=512 min=512 max=512
+	//   mem [12:00:45, 12:01:15) count=1 sum=128 min=128 max=128  <- too late to merge with the
+	//   cpu [12:00:55, 12:01:40) count=2 sum=100 min=10 max=90        emitted session, so a new one
+	//   cpu [12:02:30, 12:03:00) count=1 sum=30 min=30 max=30
+}
@@ -0,0 +1,129 @@
+// stream_test.go
+//
+// Tests for windowed aggregation. Every test drives the aggregator with a
+// fake clock, so window closing does not depend on real time.
+
+package stream
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"Golan-Concepts/pkg/clock"
+)
+
+var testStart = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// testArrivals is the event log of TestWindows.
+func testArrivals() []arrival {
+	at := func(d time.Duration) time.Time { return testStart.Add(d) }
+	return []arrival{
+		{5 * time.Second, Event{"cpu", 40, at(5 * time.Second)}},
+		{20 * time.Second, Event{"cpu", 60, at(20 * time.Second)}},
+		{30 * time.Second, Event{"mem", 512, at(30 * time.Second)}},
+		{70 * time.Second, Event{"cpu", 90, at(70 * time.Second)}},
+		{75 * time.Second, Event{"cpu", 10, at(55 * time.Second)}},
+		{100 * time.Second, Event{"mem", 128, at(45 * time.Second)}},
+		{150 * time.Second, Event{"cpu", 30, at(150 * time.Second)}},
+	}
+}
+
+// run replays testArrivals through windows with 30s allowed lateness. It
+// fails t if a window is emitted before the fake clock has passed its end
+// plus the lateness.
+func run(t *testing.T, windows Windows) (results []string, late []Event) {
+	t.Helper()
+	const lateness = 30 * time.Second
+	fake := clock.NewFake(testStart)
+	out := Windowed(replay(fake, testStart, testArrivals()), Options{
+		Windows:         windows,
+		AllowedLateness: lateness,
+		Clock:           fake,
+		OnLate:          func(e Event) { late = append(late, e) },
+	})
+	for r := range out {
+		if now := fake.Now(); now.Before(r.End.Add(lateness)) {
+			t.Errorf("%v emitted at %s, before its lateness ran out", r, now.Format("15:04:05"))
+		}
+		results = append(results, r.String())
+	}
+	return results, late
+}
+
+func TestTumblingWindows(t *testing.T) {
+	results, late := run(t, Tumbling(time.Minute))
+	want := []string{
+		"cpu [12:00:00, 12:01:00) count=3 sum=110 min=10 max=60",
+		"mem [12:00:00, 12:01:00) count=1 sum=512 min=512 max=512",
+		"cpu [12:01:00, 12:02:00) count=1 sum=90 min=90 max=90",
+		"cpu [12:02:00, 12:03:00) count=1 sum=30 min=30 max=30",
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results:\n%q\nwant:\n%q", results, want)
+	}
+	if len(late) != 1 || late[0].Key != "mem" || late[0].Value != 128 {
+		t.Errorf("late = %v, want the mem 128 event", late)
+	}
+}
+
+func TestSlidingWindowsHoldEveryEventTwice(t *testing.T) {
+	fake := clock.NewFake(testStart)
+	out := Windowed(replay(fake, testStart, testArrivals()), Options{
+		Windows:         Sliding(time.Minute, 30*time.Second),
+		AllowedLateness: 30 * time.Second,
+		Clock:           fake,
+	})
+	var count int
+	for r := range out {
+		if r.End.Sub(r.Start) != time.Minute || r.Start.Sub(testStart)%(30*time.Second) != 0 {
+			t.Errorf("window %v is not a 1m window aligned to 30s", r)
+		}
+		count += r.Count
+	}
+	// Every event is in two windows. The mem event from 12:00:45 arrives at
+	// 12:01:40, after [12:00:00, 12:01:00) closed but while [12:00:30,
+	// 12:01:30) is still open, so it is counted once, the others twice.
+	if want := 6*2 + 1; count != want {
+		t.Errorf("events counted %d times in total, want %d", count, want)
+	}
+}
+
+func TestSessionWindows(t *testing.T) {
+	results, late := run(t, Session(30*time.Second))
+	want := []string{
+		"cpu [12:00:05, 12:00:50) count=2 sum=100 min=40 max=60",
+		"mem [12:00:30, 12:01:00) count=1 sum=512 min=512 max=512",
+		"mem [12:00:45, 12:01:15) count=1 sum=128 min=128 max=128",
+		"cpu [12:00:55, 12:01:40) count=2 sum=100 min=10 max=90",
+		"cpu [12:02:30, 12:03:00) count=1 sum=30 min=30 max=30",
+	}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results:\n%q\nwant:\n%q", results, want)
+	}
+	if len(late) != 0 {
+		t.Errorf("late = %v, want none", late)
+	}
+}
+
+func TestInvalidWindowsPanic(t *testing.T) {
+	for name, f := range map[string]func(){
+		"Tumbling(0)":       func() { Tumbling(0) },
+		"Sliding(1m, 0)":    func() { Sliding(time.Minute, 0) },
+		"Sliding(0, 1s)":    func() { Sliding(0, time.Second) },
+		"Sliding(1s, 1m)":   func() { Sliding(time.Second, time.Minute) },
+		"Session(-1s)":      func() { Session(-time.Second) },
+		"zero Windows":      func() { Windowed(make(chan Event), Options{}) },
+		"Tumbling(-1m)":     func() { Tumbling(-time.Minute) },
+		"Sliding(-1m, -1s)": func() { Sliding(-time.Minute, -time.Second) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s did not panic", name)
+				}
+			}()
+			f()
+		})
+	}
+}
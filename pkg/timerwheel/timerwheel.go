@@ -0,0 +1,435 @@
+// timerwheel.go
+//
+// This package provides a hierarchical timer wheel, for programs that keep
+// hundreds of thousands of pending timeouts (one per connection, request or
+// session), and a DelayQueue whose items become available after a deadline.
+
+package timerwheel
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ==============================
+// Timer Wheels
+// ==============================
+//
+// time.AfterFunc is exact and easy, but every timer lives in the runtime's
+// timer heap: scheduling and cancelling cost O(log n), and every timer that
+// fires starts a goroutine. Most connection timeouts never fire; they are
+// scheduled, then cancelled when the request completes.
+//
+// A timer wheel trades precision for O(1) schedule and cancel. Time is cut
+// into ticks, and a wheel of slots holds a list of timers per tick, like the
+// face of a clock:
+//
+//                 slot 0
+//             63 .-----. 1        the hand moves one slot per tick and
+//              /    |    \        fires every timer in the slot it reaches
+//          62 |     +--   | 2
+//              \         /
+//               '-------'
+//
+// One wheel of 64 slots only covers 64 ticks. A hierarchical wheel stacks
+// wheels like the hands of a clock: level 0 has one slot per tick, level 1 one
+// slot per 64 ticks, level 2 one per 64*64 ticks, and so on. A timer far in the
+// future sits in a coarse slot; when the lower wheel completes a turn, the next
+// coarse slot is "cascaded": its timers are re-inserted into finer wheels.
+// This is the design of the classic Linux kernel timer wheel.
+//
+// Timers fire on the tick boundary at or after their deadline, so the
+// resolution is one tick. The five levels reach 64^5 ticks ahead (about 12
+// days at 1ms per tick). A timer further out is parked in the farthest top
+// level slot; when that slot is cascaded the timer is simply added again,
+// and parked again if it is still out of reach, until it fits.
+
+const (
+	levelBits = 6
+	levelSize = 1 << levelBits // slots per level
+	levelMask = levelSize - 1
+	levels    = 5 // 64^5 ticks: about 12 days at 1ms per tick
+	maxTicks  = 1<<(levelBits*levels) - 1
+)
+
+// Timer is a scheduled callback. Cancel it with Cancel.
+type Timer struct {
+	expires    uint64
+	fn         func()
+	prev, next *Timer
+	slot       *slot
+	wheel      *Wheel
+}
+
+// slot is a doubly linked list of timers, so a timer can unlink itself in O(1).
+type slot struct {
+	head *Timer
+}
+
+func (s *slot) push(t *Timer) {
+	t.slot = s
+	t.prev = nil
+	t.next = s.head
+	if s.head != nil {
+		s.head.prev = t
+	}
+	s.head = t
+}
+
+func (s *slot) remove(t *Timer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		s.head = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev, t.next, t.slot = nil, nil, nil
+}
+
+// take empties the slot and returns its timers.
+func (s *slot) take() *Timer {
+	head := s.head
+	s.head = nil
+	return head
+}
+
+// Wheel is a hierarchical timer wheel. Create it with New and release it
+// with Stop.
+type Wheel struct {
+	mu      sync.Mutex
+	tick    time.Duration
+	start   time.Time
+	current uint64 // next tick to process
+	wheels  [levels][levelSize]slot
+	count   int
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// New starts a wheel that advances every tick.
+//
+// Callbacks run one after another on the wheel's own goroutine, so they must
+// be quick; start a goroutine from the callback for anything slow.
+func New(tick time.Duration) *Wheel {
+	if tick <= 0 {
+		tick = time.Millisecond
+	}
+	w := &Wheel{
+		tick:    tick,
+		start:   time.Now(),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Schedule runs fn once d has elapsed, rounded up to the next tick. There
+// is no upper limit on d; timers beyond the wheel's reach are re-cascaded.
+func (w *Wheel) Schedule(d time.Duration, fn func()) *Timer {
+	ticks := uint64(0)
+	if d > 0 {
+		ticks = uint64(d / w.tick)
+		if d%w.tick != 0 {
+			ticks++
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	// The wheel only processes ticks that have fully elapsed, so measure
+	// from the tick that is currently in progress.
+	elapsed := uint64(time.Since(w.start) / w.tick)
+	if elapsed < w.current {
+		elapsed = w.current
+	}
+	t := &Timer{expires: elapsed + ticks, fn: fn, wheel: w}
+	w.add(t)
+	w.count++
+	return t
+}
+
+// Cancel stops the timer. It reports whether the timer was still pending;
+// false means it already fired or was already cancelled.
+func (t *Timer) Cancel() bool {
+	w := t.wheel
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if t.slot == nil {
+		return false
+	}
+	t.slot.remove(t)
+	w.count--
+	return true
+}
+
+// Len returns the number of pending timers.
+func (w *Wheel) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.count
+}
+
+// Stop stops the wheel. Pending timers never fire.
+func (w *Wheel) Stop() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	<-w.stopped
+}
+
+// add puts t in the slot matching how far in the future it expires.
+// The caller must hold w.mu.
+func (w *Wheel) add(t *Timer) {
+	if t.expires < w.current {
+		t.expires = w.current // already due: fire on the next tick
+	}
+	at := t.expires
+	if at-w.current > maxTicks {
+		// Out of reach: park it at the furthest tick the wheel can hold.
+		// t.expires is kept, so the cascade that brings it down adds it
+		// again with its real deadline.
+		at = w.current + maxTicks
+	}
+	delta := at - w.current
+	level := 0
+	for delta >= levelSize<<(levelBits*level) && level < levels-1 {
+		level++
+	}
+	index := (at >> (levelBits * level)) & levelMask
+	w.wheels[level][index].push(t)
+}
+
+// advance processes every tick before `until` and returns the timers that
+// expired, in no particular order. The caller must hold w.mu.
+func (w *Wheel) advance(until uint64) []*Timer {
+	var expired []*Timer
+	for w.current < until {
+		index := w.current & levelMask
+		if index == 0 {
+			// Level 0 completed a turn: pull the next slot of each
+			// higher level down, stopping at the first level that did not wrap.
+			for level := 1; level < levels; level++ {
+				i := (w.current >> (levelBits * level)) & levelMask
+				for t := w.wheels[level][i].take(); t != nil; {
+					next := t.next
+					w.add(t)
+					t = next
+				}
+				if i != 0 {
+					break
+				}
+			}
+		}
+		for t := w.wheels[0][index].take(); t != nil; {
+			next := t.next
+			t.prev, t.next, t.slot = nil, nil, nil
+			expired = append(expired, t)
+			t = next
+		}
+		w.current++
+	}
+	w.count -= len(expired)
+	return expired
+}
+
+func (w *Wheel) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case now := <-ticker.C:
+			w.mu.Lock()
+			expired := w.advance(uint64(now.Sub(w.start) / w.tick))
+			w.mu.Unlock()
+			for _, t := range expired {
+				t.fn()
+			}
+		}
+	}
+}
+
+// ==============================
+// Delay Queue
+// ==============================
+//
+// A DelayQueue holds items that may not be taken before their deadline, e.g.
+// connections to close when idle or retries to send after a backoff. Items
+// come out in deadline order, no matter the order they were put in:
+//
+//     Put(c, now+3s)  Put(a, now+1s)  Put(b, now+2s)
+//     Take() -> a (after 1s)   Take() -> b (after 2s)   Take() -> c (after 3s)
+//
+// It is a min-heap ordered by deadline. Take sleeps until the head's deadline;
+// a Put that becomes the new head wakes the sleepers so they can re-check.
+
+// delayed is one item in the queue. seq keeps items with equal deadlines FIFO.
+type delayed[T any] struct {
+	value    T
+	deadline time.Time
+	seq      uint64
+}
+
+type delayHeap[T any] []delayed[T]
+
+func (h delayHeap[T]) Len() int { return len(h) }
+func (h delayHeap[T]) Less(i, j int) bool {
+	if h[i].deadline.Equal(h[j].deadline) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].deadline.Before(h[j].deadline)
+}
+func (h delayHeap[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *delayHeap[T]) Push(x any)   { *h = append(*h, x.(delayed[T])) }
+func (h *delayHeap[T]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// DelayQueue is an unbounded queue of items that become available after
+// their deadline. Create it with NewDelayQueue.
+type DelayQueue[T any] struct {
+	mu      sync.Mutex
+	items   delayHeap[T]
+	seq     uint64
+	changed chan struct{} // closed and replaced when the head changes
+}
+
+// NewDelayQueue returns an empty queue.
+func NewDelayQueue[T any]() *DelayQueue[T] {
+	return &DelayQueue[T]{changed: make(chan struct{})}
+}
+
+// Put adds v, to become available at deadline.
+func (q *DelayQueue[T]) Put(v T, deadline time.Time) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.seq++
+	heap.Push(&q.items, delayed[T]{value: v, deadline: deadline, seq: q.seq})
+	if q.items[0].seq == q.seq {
+		close(q.changed)
+		q.changed = make(chan struct{})
+	}
+}
+
+// PutAfter adds v, to become available after d.
+func (q *DelayQueue[T]) PutAfter(v T, d time.Duration) {
+	q.Put(v, time.Now().Add(d))
+}
+
+// Poll removes and returns the first expired item without waiting.
+func (q *DelayQueue[T]) Poll() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.pollLocked(time.Now())
+}
+
+func (q *DelayQueue[T]) pollLocked(now time.Time) (T, bool) {
+	if len(q.items) == 0 || q.items[0].deadline.After(now) {
+		var zero T
+		return zero, false
+	}
+	return heap.Pop(&q.items).(delayed[T]).value, true
+}
+
+// Take removes and returns the first item, waiting until its deadline has
+// passed or ctx is done.
+func (q *DelayQueue[T]) Take(ctx context.Context) (T, error) {
+	for {
+		q.mu.Lock()
+		now := time.Now()
+		if v, ok := q.pollLocked(now); ok {
+			q.mu.Unlock()
+			return v, nil
+		}
+		var wait <-chan time.Time
+		var timer *time.Timer
+		if len(q.items) > 0 {
+			timer = time.NewTimer(q.items[0].deadline.Sub(now))
+			wait = timer.C
+		}
+		changed := q.changed
+		q.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-changed:
+		case <-ctx.Done():
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if err := ctx.Err(); err != nil {
+			var zero T
+			return zero, err
+		}
+	}
+}
+
+// Len returns the number of items, expired or not.
+func (q *DelayQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+// ==============================
+// Examples
+// ==============================
+
+// TestTimerWheel schedules a few timeouts out of order and cancels one.
+func TestTimerWheel() {
+	w := New(10 * time.Millisecond)
+	defer w.Stop()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, d := range []time.Duration{300, 100, 200, 2000} {
+		d := d * time.Millisecond
+		wg.Add(1)
+		w.Schedule(d, func() {
+			defer wg.Done()
+			fmt.Printf("timeout %v fired after %v\n", d, time.Since(start).Round(10*time.Millisecond))
+		})
+	}
+	cancelled := w.Schedule(150*time.Millisecond, func() { fmt.Println("never printed") })
+	fmt.Println("cancelled:", cancelled.Cancel(), "pending:", w.Len())
+	wg.Wait()
+	// cancelled: true pending: 4
+	// timeout 100ms fired after 110ms
+	// timeout 200ms fired after 210ms
+	// timeout 300ms fired after 310ms
+	// timeout 2s fired after 2.01s     <- cascaded down from level 1
+}
+
+// TestDelayQueue puts items in random order; Take returns them in deadline order.
+func TestDelayQueue() {
+	q := NewDelayQueue[string]()
+	start := time.Now()
+	q.PutAfter("c", 300*time.Millisecond)
+	q.PutAfter("a", 100*time.Millisecond)
+	q.PutAfter("b", 200*time.Millisecond)
+
+	_, ok := q.Poll()
+	fmt.Println("poll before any deadline:", ok)
+	for q.Len() > 0 {
+		v, _ := q.Take(context.Background())
+		fmt.Printf("%s after %v\n", v, time.Since(start).Round(10*time.Millisecond))
+	}
+	// poll before any deadline: false
+	// a after 100ms
+	// b after 200ms
+	// c after 300ms
+}
@@ -0,0 +1,161 @@
+// timerwheel_test.go
+//
+// Tests and benchmarks for the timer wheel. Run the benchmarks with:
+//
+//     go test -run '^$' -bench TimerWheel -benchmem ./pkg/timerwheel
+
+package timerwheel
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newStoppedWheel returns a wheel without its ticking goroutine, so a test
+// can drive advance itself.
+func newStoppedWheel() *Wheel {
+	return &Wheel{tick: time.Millisecond, start: time.Now()}
+}
+
+// inTopLevel reports whether t is parked in the coarsest level.
+func inTopLevel(w *Wheel, t *Timer) bool {
+	for i := range w.wheels[levels-1] {
+		if t.slot == &w.wheels[levels-1][i] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTimerBeyondReachFiresOnTime(t *testing.T) {
+	w := newStoppedWheel()
+	const expires = 2*maxTicks + 12345
+	timer := &Timer{expires: expires, wheel: w}
+	w.add(timer)
+	w.count++
+
+	// Stepping through billions of empty ticks one by one would take too
+	// long. While the timer sits in the top level nothing else is pending,
+	// so jump straight to the tick before the next top-level cascade.
+	for inTopLevel(w, timer) {
+		next := (w.current>>(levelBits*(levels-1)) + 1) << (levelBits * (levels - 1))
+		w.current = next - 1
+		if fired := w.advance(next + 1); len(fired) != 0 {
+			t.Fatalf("timer fired at tick %d, want %d", w.current, uint64(expires))
+		}
+	}
+
+	if fired := w.advance(expires); len(fired) != 0 {
+		t.Fatalf("timer fired before tick %d", uint64(expires))
+	}
+	if fired := w.advance(expires + 1); len(fired) != 1 || fired[0] != timer {
+		t.Fatalf("timer did not fire at tick %d", uint64(expires))
+	}
+	if w.count != 0 {
+		t.Fatalf("count = %d after firing, want 0", w.count)
+	}
+}
+
+func TestScheduleCancel(t *testing.T) {
+	w := New(time.Millisecond)
+	defer w.Stop()
+
+	fired := make(chan time.Duration, 1)
+	start := time.Now()
+	w.Schedule(20*time.Millisecond, func() { fired <- time.Since(start) })
+	never := w.Schedule(10*time.Millisecond, func() { t.Error("cancelled timer fired") })
+	if !never.Cancel() || never.Cancel() {
+		t.Fatal("Cancel should report true once, then false")
+	}
+
+	select {
+	case d := <-fired:
+		if d < 20*time.Millisecond {
+			t.Fatalf("timer fired after %v, want at least 20ms", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire")
+	}
+	if n := w.Len(); n != 0 {
+		t.Fatalf("Len = %d, want 0", n)
+	}
+}
+
+// BenchmarkTimerWheel models connection timeouts: each connection schedules
+// a 30s timeout and cancels it when the request completes. It compares the
+// wheel with one time.AfterFunc per connection, first per operation, then
+// with 200,000 timeouts pending at once, then with timeouts that do fire:
+// the wheel runs callbacks on its own goroutine, AfterFunc starts a
+// goroutine per timer.
+//
+// Example Output (numbers vary by machine):
+//
+//	BenchmarkTimerWheel/cancel/wheel          95 ns/op    64 B/op   2 allocs/op
+//	BenchmarkTimerWheel/cancel/AfterFunc     190 ns/op   208 B/op   3 allocs/op
+//
+// The wheel's schedule and cancel do not depend on how many timers are
+// pending; the runtime heap's do, logarithmically. The wheel is only
+// accurate to one tick (1ms here).
+func BenchmarkTimerWheel(b *testing.B) {
+	const timeout = 30 * time.Second
+	w := New(time.Millisecond)
+	defer w.Stop()
+
+	cases := []struct {
+		name     string
+		schedule func(d time.Duration, fn func()) (cancel func())
+	}{
+		{"wheel", func(d time.Duration, fn func()) func() {
+			t := w.Schedule(d, fn)
+			return func() { t.Cancel() }
+		}},
+		{"AfterFunc", func(d time.Duration, fn func()) func() {
+			t := time.AfterFunc(d, fn)
+			return func() { t.Stop() }
+		}},
+	}
+
+	for _, c := range cases {
+		b.Run("cancel/"+c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				c.schedule(timeout, func() {})()
+			}
+		})
+	}
+
+	const pending = 200000
+	for _, c := range cases {
+		b.Run("pending/"+c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			cancels := make([]func(), pending)
+			for i := 0; i < b.N; i++ {
+				for j := range cancels {
+					cancels[j] = c.schedule(timeout, func() {})
+				}
+				for _, cancel := range cancels {
+					cancel()
+				}
+			}
+		})
+	}
+
+	const fired = 100000
+	for _, c := range cases {
+		b.Run("fire/"+c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				var count int64
+				done := make(chan struct{})
+				for j := 0; j < fired; j++ {
+					c.schedule(10*time.Millisecond, func() {
+						if atomic.AddInt64(&count, 1) == fired {
+							close(done)
+						}
+					})
+				}
+				<-done
+			}
+		})
+	}
+}